@@ -0,0 +1,471 @@
+// Package client renders Julia and Mandelbrot sets through a server's HTTP
+// API. Large viewports are split into tiles, as the web UI does, fetched
+// concurrently with retries, and reassembled into one buffer or image.
+//
+//	c := client.New("http://localhost:8080/satori/julia")
+//	buf, err := c.Render(ctx, client.Params{
+//		MinX: -2, MaxX: 2, MinY: -2, MaxY: 2,
+//		C:     complex(-0.4, 0.6),
+//		Width: 1024, Height: 1024,
+//	})
+package client
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for zero Client fields.
+const (
+	DefaultTileSize    = 256
+	DefaultConcurrency = 4
+	DefaultMaxRetries  = 3
+	DefaultRetryDelay  = 250 * time.Millisecond
+)
+
+// maxRetryDelay caps the wait between attempts, including one asked for by
+// Retry-After.
+const maxRetryDelay = 30 * time.Second
+
+// InteriorSentinel is the value the server reports for points that never
+// escape unless Params.Interior is set.
+const InteriorSentinel = -1.0
+
+// Fractal selects which plane a render samples.
+type Fractal string
+
+// Fractals accepted by the server.
+const (
+	Julia      Fractal = "julia"
+	Mandelbrot Fractal = "mandelbrot"
+)
+
+// Formula selects the map that is iterated.
+type Formula string
+
+// Formulas accepted by the server.
+const (
+	Polynomial  Formula = "polynomial"   // z^d + c
+	BurningShip Formula = "burning_ship" // (|Re z| + i|Im z|)^d + c
+	Tricorn     Formula = "tricorn"      // conj(z)^d + c
+	Newton      Formula = "newton"       // Newton's method for a polynomial
+	Phoenix     Formula = "phoenix"      // z^d + c + P·z_{n-1}
+	Exp         Formula = "exp"          // C·exp(z)
+	Sin         Formula = "sin"          // C·sin(z)
+	Cos         Formula = "cos"          // C·cos(z)
+	Rational    Formula = "rational"     // z^d + C + Lambda/z^PolePower
+)
+
+// Channel selects the per-pixel value a render outputs.
+type Channel string
+
+// Channels accepted by the server.
+const (
+	Smooth   Channel = "smooth"
+	Distance Channel = "distance"
+)
+
+// Params describe a render. Zero optional fields take the server defaults.
+type Params struct {
+	Fractal    Fractal // default Julia
+	Formula    Formula // default Polynomial
+	Channel    Channel // default Smooth
+	MinX, MaxX float64
+	MinY, MaxY float64
+	// C is the constant of a Julia set; Mandelbrot renders ignore it.
+	C complex128
+	// Width and Height are the size of the whole render, which may exceed
+	// the server's size limit.
+	Width  int
+	Height int
+
+	MaxIter      int
+	EscapeRadius float64
+	// Power is the degree d of z^d + c.
+	Power float64
+	// Prec is the mantissa precision in bits for math/big arithmetic. Zero
+	// lets the server choose per tile.
+	Prec uint
+	// Interior is the value rendered for points that never escape. Nil
+	// means InteriorSentinel.
+	Interior *float32
+
+	// Roots, or else Coefficients (highest degree first), give the
+	// polynomial solved by the Newton formula; neither means z^3 - 1.
+	// Newton pixels hold root index + convergence count / MaxIter.
+	Roots        []complex128
+	Coefficients []complex128
+
+	// P weights the previous iterate in the Phoenix formula, which
+	// requires it; other formulas ignore it.
+	P complex128
+
+	// Lambda and PolePower give the pole term of the Rational formula.
+	// Lambda is required on the Julia plane; zero PolePower means Power.
+	Lambda    complex128
+	PolePower int
+}
+
+// Client fetches renders from one server. Its fields must not be changed
+// while requests are in flight.
+type Client struct {
+	// BaseURL is the base path of the API, such as
+	// "http://localhost:8080/satori/julia".
+	BaseURL string
+	// HTTPClient sends requests; nil means http.DefaultClient.
+	HTTPClient *http.Client
+	// TileSize is the width and height of the tiles a render is split into;
+	// zero means DefaultTileSize.
+	TileSize int
+	// Concurrency is the number of tiles fetched at once; zero means
+	// DefaultConcurrency.
+	Concurrency int
+	// MaxRetries is the number of times a tile is retried after a transport
+	// error, 429 or 5xx response; zero means DefaultMaxRetries and a
+	// negative value disables retries.
+	MaxRetries int
+	// RetryDelay is the wait before the first retry, doubled for each
+	// further one, unless the server sends Retry-After; zero means
+	// DefaultRetryDelay.
+	RetryDelay time.Duration
+}
+
+// New returns a Client for the API at baseURL with default settings.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Errors matched by errors.Is against an *Error.
+var (
+	// ErrInvalidParams reports that the server rejected the parameters.
+	ErrInvalidParams = errors.New("invalid parameters")
+	// ErrBusy reports that the server's render queue was full.
+	ErrBusy = errors.New("server busy")
+)
+
+// Error is an error response from the server.
+type Error struct {
+	StatusCode int
+	// Message is the error message from the JSON body, or the status text
+	// if there was none.
+	Message string
+	// RequestID is the server's X-Request-ID for the failed request, for
+	// finding it in the access log.
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether e is ErrInvalidParams (a 400 response) or ErrBusy
+// (a 503 response).
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrInvalidParams:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrBusy:
+		return e.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// Render returns the per-pixel values of p, row by row from MinY, as the
+// API's raw format does.
+func (c *Client) Render(ctx context.Context, p Params) ([]float32, error) {
+	if err := c.check(p); err != nil {
+		return nil, err
+	}
+	buf := make([]float32, p.Width*p.Height)
+	err := c.fetchTiles(ctx, p, "raw", func(t tile, body []byte) error {
+		if len(body) != t.w*t.h*4 {
+			return fmt.Errorf("got %d bytes, want %d", len(body), t.w*t.h*4)
+		}
+		for y := 0; y < t.h; y++ {
+			row := buf[(t.y+y)*p.Width+t.x:][:t.w]
+			for x := range row {
+				row[x] = math.Float32frombits(binary.LittleEndian.Uint32(body[(y*t.w+x)*4:]))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Image returns p colored by the server, as the API's png format does.
+func (c *Client) Image(ctx context.Context, p Params) (*image.RGBA, error) {
+	if err := c.check(p); err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, p.Width, p.Height))
+	err := c.fetchTiles(ctx, p, "png", func(t tile, body []byte) error {
+		part, err := png.Decode(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if b := part.Bounds(); b.Dx() != t.w || b.Dy() != t.h {
+			return fmt.Errorf("got %dx%d image, want %dx%d", b.Dx(), b.Dy(), t.w, t.h)
+		}
+		draw.Draw(img, image.Rect(t.x, t.y, t.x+t.w, t.y+t.h), part, part.Bounds().Min, draw.Src)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// check reports settings and parameters that cannot be split into tiles.
+// The server validates the rest.
+func (c *Client) check(p Params) error {
+	switch {
+	case p.Width < 1 || p.Height < 1:
+		return fmt.Errorf("client: width and height must be positive, got %dx%d", p.Width, p.Height)
+	case c.TileSize < 0:
+		return fmt.Errorf("client: tile size must not be negative, got %d", c.TileSize)
+	case c.Concurrency < 0:
+		return fmt.Errorf("client: concurrency must not be negative, got %d", c.Concurrency)
+	}
+	return nil
+}
+
+// tile is a rectangle of the render, in pixels.
+type tile struct {
+	x, y, w, h int
+}
+
+// tiles splits p into tiles of at most size pixels square.
+func tiles(p Params, size int) []tile {
+	var ts []tile
+	for y := 0; y < p.Height; y += size {
+		for x := 0; x < p.Width; x += size {
+			ts = append(ts, tile{x, y, min(size, p.Width-x), min(size, p.Height-y)})
+		}
+	}
+	return ts
+}
+
+// fetchTiles fetches every tile of p in the given format and passes each
+// body to put, which may be called concurrently for different tiles. It
+// stops at the first error.
+func (c *Client) fetchTiles(ctx context.Context, p Params, format string, put func(t tile, body []byte) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ts := tiles(p, cmp.Or(c.TileSize, DefaultTileSize))
+	next := make(chan tile)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	for range min(cmp.Or(c.Concurrency, DefaultConcurrency), len(ts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range next {
+				body, err := c.fetch(ctx, c.tileURL(p, t, format))
+				if err == nil {
+					err = put(t, body)
+				}
+				if err != nil {
+					fail(fmt.Errorf("client: tile at %d,%d: %w", t.x, t.y, err))
+				}
+			}
+		}()
+	}
+send:
+	for _, t := range ts {
+		select {
+		case next <- t:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// tileURL returns the API URL for tile t of p, mapping its pixels onto the
+// complex plane as the web UI does.
+func (c *Client) tileURL(p Params, t tile, format string) string {
+	spanX, spanY := p.MaxX-p.MinX, p.MaxY-p.MinY
+	w, h := float64(p.Width), float64(p.Height)
+
+	q := url.Values{}
+	q.Set("min_x", formatFloat(p.MinX+spanX*float64(t.x)/w))
+	q.Set("max_x", formatFloat(p.MinX+spanX*float64(t.x+t.w)/w))
+	q.Set("min_y", formatFloat(p.MinY+spanY*float64(t.y)/h))
+	q.Set("max_y", formatFloat(p.MinY+spanY*float64(t.y+t.h)/h))
+	q.Set("comp_const", formatComplex(p.C))
+	q.Set("width", strconv.Itoa(t.w))
+	q.Set("height", strconv.Itoa(t.h))
+	q.Set("format", format)
+	if p.Fractal != "" {
+		q.Set("fractal", string(p.Fractal))
+	}
+	if p.Formula != "" {
+		q.Set("formula", string(p.Formula))
+	}
+	if p.Channel != "" {
+		q.Set("channel", string(p.Channel))
+	}
+	if p.MaxIter != 0 {
+		q.Set("max_iter", strconv.Itoa(p.MaxIter))
+	}
+	if p.EscapeRadius != 0 {
+		q.Set("escape_radius", formatFloat(p.EscapeRadius))
+	}
+	if p.Power != 0 {
+		q.Set("power", formatFloat(p.Power))
+	}
+	if p.Prec != 0 {
+		q.Set("precision", strconv.FormatUint(uint64(p.Prec), 10))
+	}
+	if p.Interior != nil {
+		q.Set("interior_value", strconv.FormatFloat(float64(*p.Interior), 'g', -1, 32))
+	}
+	if p.Formula == Phoenix {
+		q.Set("p", formatComplex(p.P))
+	}
+	if p.Formula == Rational {
+		q.Set("lambda", formatComplex(p.Lambda))
+		if p.PolePower != 0 {
+			q.Set("pole_power", strconv.Itoa(p.PolePower))
+		}
+	}
+	for _, r := range p.Roots {
+		q.Add("root", formatComplex(r))
+	}
+	for _, a := range p.Coefficients {
+		q.Add("coef", formatComplex(a))
+	}
+	return c.BaseURL + "/api?" + q.Encode()
+}
+
+// fetch GETs u and returns the response body, retrying transport errors,
+// 429 and 5xx responses.
+func (c *Client) fetch(ctx context.Context, u string) ([]byte, error) {
+	retries := cmp.Or(c.MaxRetries, DefaultMaxRetries)
+	delay := cmp.Or(c.RetryDelay, DefaultRetryDelay)
+	for attempt := 0; ; attempt++ {
+		body, retryAfter, err := c.get(ctx, u)
+		// A negative MaxRetries stops after the first attempt.
+		if err == nil || attempt >= retries || !retryable(err) || ctx.Err() != nil {
+			return body, err
+		}
+		wait := backoff(delay, attempt)
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		timer := time.NewTimer(min(wait, maxRetryDelay))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backoff returns the wait before retry attempt+1, delay doubled attempt
+// times and capped at maxRetryDelay without overflowing.
+func backoff(delay time.Duration, attempt int) time.Duration {
+	if attempt >= 63 || delay > maxRetryDelay>>attempt {
+		return maxRetryDelay
+	}
+	return delay << attempt
+}
+
+// get makes one GET request for u, returning the body of a 200 response or
+// an error, with the delay asked for by Retry-After if any.
+func (c *Client) get(ctx context.Context, u string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return body, 0, nil
+	}
+
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    http.StatusText(resp.StatusCode),
+		RequestID:  resp.Header.Get("X-Request-ID"),
+	}
+	var errBody struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &errBody) == nil && errBody.Error != "" {
+		e.Message = errBody.Error
+	}
+	var retryAfter time.Duration
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		retryAfter = time.Duration(s) * time.Second
+	}
+	return nil, retryAfter, e
+}
+
+// retryable reports whether a request that failed with err may succeed if
+// repeated.
+func retryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500 && e.StatusCode != http.StatusNotImplemented
+	}
+	// Transport errors other than cancellation.
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// formatFloat formats f with every digit needed to parse it back exactly.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatComplex formats z in the real,imag syntax of the API.
+func formatComplex(z complex128) string {
+	return formatFloat(real(z)) + "," + formatFloat(imag(z))
+}
@@ -0,0 +1,338 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kqnade/julia-web-server/juliaweb"
+)
+
+// positionServer answers raw requests with pixel values y*10000 + x, where
+// x and y are the global pixel coordinates of a render whose viewport is
+// [0, width] x [0, height], so tile bounds are whole pixels.
+func positionServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("format") != "raw" {
+			http.Error(w, "want format=raw", http.StatusBadRequest)
+			return
+		}
+		minX, _ := strconv.ParseFloat(q.Get("min_x"), 64)
+		minY, _ := strconv.ParseFloat(q.Get("min_y"), 64)
+		width, _ := strconv.Atoi(q.Get("width"))
+		height, _ := strconv.Atoi(q.Get("height"))
+		buf := make([]float32, width*height)
+		for y := range height {
+			for x := range width {
+				buf[y*width+x] = float32((int(minY)+y)*10000 + int(minX) + x)
+			}
+		}
+		binary.Write(w, binary.LittleEndian, buf)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRender_Reassembles(t *testing.T) {
+	srv := positionServer(t)
+	tests := []struct {
+		name          string
+		width, height int
+		tileSize      int
+		concurrency   int
+	}{
+		{"single tile", 100, 50, 0, 0},
+		{"exact tiles", 256, 128, 64, 2},
+		{"partial tiles", 300, 200, 128, 0},
+		{"one worker", 70, 30, 16, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(srv.URL)
+			c.TileSize = tt.tileSize
+			c.Concurrency = tt.concurrency
+			p := Params{MaxX: float64(tt.width), MaxY: float64(tt.height), Width: tt.width, Height: tt.height}
+			buf, err := c.Render(context.Background(), p)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if len(buf) != tt.width*tt.height {
+				t.Fatalf("len = %d, want %d", len(buf), tt.width*tt.height)
+			}
+			for y := range tt.height {
+				for x := range tt.width {
+					if got, want := buf[y*tt.width+x], float32(y*10000+x); got != want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRender_Query(t *testing.T) {
+	var got url.Values
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, path = r.URL.Query(), r.URL.Path
+		binary.Write(w, binary.LittleEndian, make([]float32, 4))
+	}))
+	defer srv.Close()
+
+	interior := float32(math.NaN())
+	_, err := New(srv.URL+"/fractals/").Render(context.Background(), Params{
+		Fractal: Mandelbrot, Formula: Phoenix, Channel: Distance,
+		MinX: -2, MaxX: 1, MinY: -1.5, MaxY: 1.5,
+		C:     complex(-0.4, 0.6),
+		Width: 2, Height: 2,
+		MaxIter: 500, EscapeRadius: 100, Power: 3, Prec: 128,
+		Interior:     &interior,
+		Roots:        []complex128{1, -1i},
+		Coefficients: []complex128{1, 0, -1},
+		P:            complex(-0.5, 0.25),
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if path != "/fractals/api" {
+		t.Errorf("path = %q, want /fractals/api", path)
+	}
+	want := map[string]string{
+		"fractal": "mandelbrot", "formula": "phoenix", "channel": "distance",
+		"min_x": "-2", "max_x": "1", "min_y": "-1.5", "max_y": "1.5",
+		"comp_const": "-0.4,0.6", "width": "2", "height": "2",
+		"max_iter": "500", "escape_radius": "100", "power": "3", "precision": "128",
+		"interior_value": "NaN", "p": "-0.5,0.25", "format": "raw",
+	}
+	for k, v := range want {
+		if got.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, got.Get(k), v)
+		}
+	}
+	if !slices.Equal(got["root"], []string{"1,0", "0,-1"}) {
+		t.Errorf("root = %q, want [1,0 0,-1]", got["root"])
+	}
+	if !slices.Equal(got["coef"], []string{"1,0", "0,0", "-1,0"}) {
+		t.Errorf("coef = %q, want [1,0 0,0 -1,0]", got["coef"])
+	}
+
+	_, err = New(srv.URL).Render(context.Background(), Params{
+		Formula: Rational,
+		MinX:    -2, MaxX: 2, MinY: -2, MaxY: 2,
+		Width: 2, Height: 2,
+		P:      1,
+		Lambda: complex(0.01, -0.02), PolePower: 3,
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want = map[string]string{"formula": "rational", "lambda": "0.01,-0.02", "pole_power": "3", "p": ""}
+	for k, v := range want {
+		if got.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, got.Get(k), v)
+		}
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		okAfter      int // attempts after which the server succeeds, 0 for never
+		maxRetries   int
+		wantAttempts int32
+		wantIs       error
+		wantMessage  string
+	}{
+		{"bad request", http.StatusBadRequest, `{"error":"missing required parameter: comp_const"}`, 0, 0, 1, ErrInvalidParams, "missing required parameter: comp_const"},
+		{"busy then ok", http.StatusServiceUnavailable, `{"error":"server busy: render queue is full"}`, 2, 0, 3, nil, ""},
+		{"busy throughout", http.StatusServiceUnavailable, `{"error":"server busy: render queue is full"}`, 0, 2, 3, ErrBusy, "server busy: render queue is full"},
+		{"large max retries", http.StatusServiceUnavailable, `{"error":"server busy: render queue is full"}`, 3, math.MaxInt, 4, nil, ""},
+		{"retries disabled", http.StatusServiceUnavailable, `{"error":"server busy: render queue is full"}`, 0, -1, 1, ErrBusy, "server busy: render queue is full"},
+		{"no JSON body", http.StatusBadGateway, "upstream gone", 0, 1, 2, nil, "Bad Gateway"},
+		{"not found", http.StatusNotFound, "404 page not found", 0, 0, 1, nil, "Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if n := attempts.Add(1); tt.okAfter > 0 && int(n) > tt.okAfter {
+					binary.Write(w, binary.LittleEndian, make([]float32, 4))
+					return
+				}
+				w.Header().Set("X-Request-ID", "req-1")
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			c := New(srv.URL)
+			c.MaxRetries = tt.maxRetries
+			c.RetryDelay = 1
+			_, err := c.Render(context.Background(), Params{MaxX: 1, MaxY: 1, Width: 2, Height: 2})
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			if tt.wantMessage == "" {
+				if err != nil {
+					t.Fatalf("Render: %v", err)
+				}
+				return
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("err = %v, want *Error", err)
+			}
+			if e.StatusCode != tt.status || e.Message != tt.wantMessage || e.RequestID != "req-1" {
+				t.Errorf("err = %+v, want status %d, message %q, request ID req-1", e, tt.status, tt.wantMessage)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.wantIs)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		delay   time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{DefaultRetryDelay, 0, DefaultRetryDelay},
+		{DefaultRetryDelay, 3, 8 * DefaultRetryDelay},
+		{DefaultRetryDelay, 7, maxRetryDelay},
+		{1, 34, 1 << 34},
+		{1, 35, maxRetryDelay},
+		{DefaultRetryDelay, 40, maxRetryDelay},
+		{DefaultRetryDelay, 63, maxRetryDelay},
+		{1, 64, maxRetryDelay},
+		{time.Hour, 0, maxRetryDelay},
+		{DefaultRetryDelay, math.MaxInt32, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.delay, tt.attempt); got != tt.want {
+			t.Errorf("backoff(%v, %d) = %v, want %v", tt.delay, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRender_InvalidParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		client Client
+		p      Params
+	}{
+		{"zero width", Client{}, Params{Height: 1}},
+		{"negative height", Client{}, Params{Width: 1, Height: -1}},
+		{"negative tile size", Client{TileSize: -1}, Params{Width: 1, Height: 1}},
+		{"negative concurrency", Client{Concurrency: -1}, Params{Width: 1, Height: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.client.Render(context.Background(), tt.p); err == nil {
+				t.Error("Render succeeded, want error")
+			}
+			if _, err := tt.client.Image(context.Background(), tt.p); err == nil {
+				t.Error("Image succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRender_Cancelled(t *testing.T) {
+	srv := positionServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := New(srv.URL).Render(ctx, Params{MaxX: 1, MaxY: 1, Width: 4, Height: 4})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+// TestServer renders through a real server and compares the tiled result
+// with a single request for the whole viewport.
+func TestServer(t *testing.T) {
+	h, err := juliaweb.New(juliaweb.Options{BasePath: "/satori/julia", Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatalf("juliaweb.New: %v", err)
+	}
+	defer h.Close()
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	p := Params{MinX: -1.5, MaxX: 1.5, MinY: -1, MaxY: 1, C: complex(-0.4, 0.6), Width: 96, Height: 64, MaxIter: 100}
+	whole := New(srv.URL + "/satori/julia")
+	whole.TileSize = 128
+	tiled := New(srv.URL + "/satori/julia")
+	tiled.TileSize = 32
+
+	want, err := whole.Render(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Render whole: %v", err)
+	}
+	got, err := tiled.Render(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Render tiled: %v", err)
+	}
+	// Tile bounds are rounded, so pixels may move by an ulp of the plane.
+	var differ int
+	for i := range want {
+		if math.Abs(float64(got[i]-want[i])) > 1e-3 {
+			differ++
+		}
+	}
+	if differ > len(want)/100 {
+		t.Errorf("%d of %d pixels differ between tiled and whole renders", differ, len(want))
+	}
+
+	img, err := tiled.Image(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != p.Width || b.Dy() != p.Height {
+		t.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), p.Width, p.Height)
+	}
+	resp, err := http.Get(srv.URL + "/satori/julia/api?min_x=-1.5&max_x=1.5&min_y=-1&max_y=1&comp_const=-0.4,0.6&width=96&height=64&max_iter=100&format=png")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	ref, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("decoding reference PNG: %v", err)
+	}
+	differ = 0
+	for y := range p.Height {
+		for x := range p.Width {
+			r1, g1, b1, _ := img.At(x, y).RGBA()
+			r2, g2, b2, _ := ref.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				differ++
+			}
+		}
+	}
+	if differ > len(want)/100 {
+		t.Errorf("%d of %d image pixels differ between tiled and whole renders", differ, len(want))
+	}
+
+	_, err = tiled.Render(context.Background(), Params{MinX: 1, MaxX: -1, MinY: -1, MaxY: 1, Width: 4, Height: 4})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("inverted viewport: err = %v, want ErrInvalidParams", err)
+	}
+}
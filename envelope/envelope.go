@@ -0,0 +1,362 @@
+// Package envelope reads and writes the self-describing binary container
+// the server returns for format=envelope, so archived renders can be
+// reloaded and validated without the URL that produced them.
+//
+// An envelope is laid out as follows (all integers little-endian):
+//
+//	offset  size  field
+//	0       4     magic "JLST"
+//	4       2     format version (currently 1)
+//	6       2     dtype (1 = float32)
+//	8       4     width in pixels
+//	12      4     height in pixels
+//	16      4     value of interior samples (float32, normally -1)
+//	20      4     length N of the params block
+//	24      N     params as JSON
+//	24+N    ...   width*height samples of dtype, row-major
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+)
+
+const (
+	// Version is the envelope format version written by Encode.
+	Version = 1
+
+	// DTypeFloat32 marks a body of little-endian float32 samples.
+	DTypeFloat32 = 1
+
+	// ContentType is the media type used when serving envelopes over HTTP.
+	ContentType = "application/x-julia-envelope"
+
+	// InteriorSentinel is the value of interior samples unless the render
+	// set interior_value.
+	InteriorSentinel = -1.0
+
+	headerSize = 24
+
+	// Limits that keep a malformed header from forcing huge allocations.
+	maxParamsSize = 64 << 10
+	maxSamples    = 1 << 28
+)
+
+// magic identifies an envelope stream.
+var magic = [4]byte{'J', 'L', 'S', 'T'}
+
+// ErrNotEnvelope is returned by Decode when the input does not start with
+// the envelope magic bytes.
+var ErrNotEnvelope = errors.New("envelope: missing magic bytes")
+
+// Envelope is a decoded buffer together with everything needed to interpret it.
+type Envelope struct {
+	Version  int
+	Width    int
+	Height   int
+	Interior float32
+	Params   Params
+	Data     []float32
+}
+
+// Params are the parameters of the render stored in an envelope, named as
+// in the server's query parameters. Decode fills in the default fractal,
+// formula and channel for files that omit them.
+type Params struct {
+	Fractal string // julia or mandelbrot
+	Formula string // polynomial, burning_ship, tricorn, newton, ...
+	Channel string // smooth or distance
+
+	// MinX, MaxX, MinY and MaxY are the float64 viewport; Exact, if set,
+	// holds every digit of a high-precision one.
+	MinX, MaxX, MinY, MaxY float64
+	Exact                  *Viewport
+
+	C            complex128
+	Width        int
+	Height       int
+	MaxIter      int
+	EscapeRadius float64
+	// Power is the degree d, or 0 for the default of 2.
+	Power float64
+	// Prec is the math/big precision in bits, or 0 for float64.
+	Prec uint
+
+	Roots     []complex128 // Newton
+	P         complex128   // Phoenix
+	Lambda    complex128   // Rational
+	PolePower int          // Rational, or 0 for Power
+}
+
+// Viewport is a viewport with arbitrary-precision bounds.
+type Viewport struct {
+	MinX, MaxX, MinY, MaxY *big.Float
+}
+
+// params is the JSON form of Params stored in the header. Fields added
+// after version 1 are optional so older files still decode.
+type params struct {
+	Fractal      string  `json:"fractal,omitempty"`
+	Formula      string  `json:"formula,omitempty"`
+	Channel      string  `json:"channel,omitempty"`
+	MinX         float64 `json:"min_x"`
+	MaxX         float64 `json:"max_x"`
+	MinY         float64 `json:"min_y"`
+	MaxY         float64 `json:"max_y"`
+	CReal        float64 `json:"c_real"`
+	CImag        float64 `json:"c_imag"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	MaxIter      int     `json:"max_iter"`
+	EscapeRadius float64 `json:"escape_radius"`
+	Power        float64 `json:"power,omitempty"`
+	Prec         uint    `json:"precision,omitempty"`
+	Exact        *exact  `json:"exact,omitempty"`
+	// Roots are [real, imag] pairs.
+	Roots [][2]float64 `json:"roots,omitempty"`
+	PReal float64      `json:"p_real,omitempty"`
+	PImag float64      `json:"p_imag,omitempty"`
+
+	LambdaReal float64 `json:"lambda_real,omitempty"`
+	LambdaImag float64 `json:"lambda_imag,omitempty"`
+	PolePower  int     `json:"pole_power,omitempty"`
+}
+
+// exact is the JSON form of Viewport. Bounds are decimal strings that
+// round-trip at Prec bits.
+type exact struct {
+	Prec uint   `json:"prec"`
+	MinX string `json:"min_x"`
+	MaxX string `json:"max_x"`
+	MinY string `json:"min_y"`
+	MaxY string `json:"max_y"`
+}
+
+func fromViewport(v *Viewport) *exact {
+	if v == nil {
+		return nil
+	}
+	var prec uint
+	for _, f := range []*big.Float{v.MinX, v.MaxX, v.MinY, v.MaxY} {
+		prec = max(prec, f.Prec())
+	}
+	text := func(f *big.Float) string {
+		return new(big.Float).SetPrec(prec).Set(f).Text('g', -1)
+	}
+	return &exact{Prec: prec, MinX: text(v.MinX), MaxX: text(v.MaxX), MinY: text(v.MinY), MaxY: text(v.MaxY)}
+}
+
+func (e *exact) toViewport() (*Viewport, error) {
+	if e == nil {
+		return nil, nil
+	}
+	var v Viewport
+	for _, b := range []struct {
+		dst **big.Float
+		s   string
+	}{{&v.MinX, e.MinX}, {&v.MaxX, e.MaxX}, {&v.MinY, e.MinY}, {&v.MaxY, e.MaxY}} {
+		f, _, err := big.ParseFloat(b.s, 10, e.Prec, big.ToNearestEven)
+		if err != nil {
+			return nil, fmt.Errorf("envelope: invalid exact bound %q: %w", b.s, err)
+		}
+		*b.dst = f
+	}
+	return &v, nil
+}
+
+func fromParams(p Params) params {
+	return params{
+		Fractal:      p.Fractal,
+		Formula:      p.Formula,
+		Channel:      p.Channel,
+		MinX:         p.MinX,
+		MaxX:         p.MaxX,
+		MinY:         p.MinY,
+		MaxY:         p.MaxY,
+		CReal:        real(p.C),
+		CImag:        imag(p.C),
+		Width:        p.Width,
+		Height:       p.Height,
+		MaxIter:      p.MaxIter,
+		EscapeRadius: p.EscapeRadius,
+		Power:        p.Power,
+		Prec:         p.Prec,
+		Exact:        fromViewport(p.Exact),
+		Roots:        fromRoots(p.Roots),
+		PReal:        real(p.P),
+		PImag:        imag(p.P),
+		LambdaReal:   real(p.Lambda),
+		LambdaImag:   imag(p.Lambda),
+		PolePower:    p.PolePower,
+	}
+}
+
+func fromRoots(roots []complex128) [][2]float64 {
+	if len(roots) == 0 {
+		return nil
+	}
+	out := make([][2]float64, len(roots))
+	for i, r := range roots {
+		out[i] = [2]float64{real(r), imag(r)}
+	}
+	return out
+}
+
+// toParams validates the names in j and returns them as Params, with
+// defaults for the names left out.
+func (j params) toParams() (Params, error) {
+	fractal := julia.Julia
+	if j.Fractal != "" {
+		f, ok := julia.ParseFractal(j.Fractal)
+		if !ok {
+			return Params{}, fmt.Errorf("envelope: unknown fractal %q", j.Fractal)
+		}
+		fractal = f
+	}
+	formula := julia.Polynomial
+	if j.Formula != "" {
+		f, ok := julia.ParseFormula(j.Formula)
+		if !ok {
+			return Params{}, fmt.Errorf("envelope: unknown formula %q", j.Formula)
+		}
+		formula = f
+	}
+	channel := julia.Smooth
+	if j.Channel != "" {
+		ch, ok := julia.ParseChannel(j.Channel)
+		if !ok {
+			return Params{}, fmt.Errorf("envelope: unknown channel %q", j.Channel)
+		}
+		channel = ch
+	}
+	exact, err := j.Exact.toViewport()
+	if err != nil {
+		return Params{}, err
+	}
+	var roots []complex128
+	for _, r := range j.Roots {
+		roots = append(roots, complex(r[0], r[1]))
+	}
+	return Params{
+		Fractal:      fractal.String(),
+		Formula:      formula.String(),
+		Channel:      channel.String(),
+		MinX:         j.MinX,
+		MaxX:         j.MaxX,
+		MinY:         j.MinY,
+		MaxY:         j.MaxY,
+		C:            complex(j.CReal, j.CImag),
+		Width:        j.Width,
+		Height:       j.Height,
+		MaxIter:      j.MaxIter,
+		EscapeRadius: j.EscapeRadius,
+		Power:        j.Power,
+		Prec:         j.Prec,
+		Exact:        exact,
+		Roots:        roots,
+		P:            complex(j.PReal, j.PImag),
+		Lambda:       complex(j.LambdaReal, j.LambdaImag),
+		PolePower:    j.PolePower,
+	}, nil
+}
+
+// Encode writes buf, rendered from p with interior points set to interior,
+// to w as an envelope. len(buf) must be p.Width*p.Height.
+func Encode(w io.Writer, p Params, interior float32, buf []float32) error {
+	if p.Width <= 0 || p.Height <= 0 || len(buf) != p.Width*p.Height {
+		return fmt.Errorf("envelope: buffer length %d does not match %dx%d", len(buf), p.Width, p.Height)
+	}
+
+	pj, err := json.Marshal(fromParams(p))
+	if err != nil {
+		return fmt.Errorf("envelope: encoding params: %w", err)
+	}
+
+	hdr := make([]byte, headerSize, headerSize+len(pj))
+	copy(hdr[0:4], magic[:])
+	binary.LittleEndian.PutUint16(hdr[4:6], Version)
+	binary.LittleEndian.PutUint16(hdr[6:8], DTypeFloat32)
+	binary.LittleEndian.PutUint32(hdr[8:12], uint32(p.Width))
+	binary.LittleEndian.PutUint32(hdr[12:16], uint32(p.Height))
+	binary.LittleEndian.PutUint32(hdr[16:20], math.Float32bits(interior))
+	binary.LittleEndian.PutUint32(hdr[20:24], uint32(len(pj)))
+	hdr = append(hdr, pj...)
+
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, buf)
+}
+
+// Decode reads and validates an envelope from r: the header must be of a
+// known version and dtype, the params must name a known fractal, formula
+// and channel and match the header size, and the data must be complete.
+func Decode(r io.Reader) (*Envelope, error) {
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("envelope: truncated header")
+		}
+		return nil, err
+	}
+	if !bytes.Equal(hdr[0:4], magic[:]) {
+		return nil, ErrNotEnvelope
+	}
+
+	version := binary.LittleEndian.Uint16(hdr[4:6])
+	if version != Version {
+		return nil, fmt.Errorf("envelope: unsupported version %d", version)
+	}
+	dtype := binary.LittleEndian.Uint16(hdr[6:8])
+	if dtype != DTypeFloat32 {
+		return nil, fmt.Errorf("envelope: unsupported dtype %d", dtype)
+	}
+	width := int(binary.LittleEndian.Uint32(hdr[8:12]))
+	height := int(binary.LittleEndian.Uint32(hdr[12:16]))
+	if width <= 0 || height <= 0 || width > maxSamples/height {
+		return nil, fmt.Errorf("envelope: invalid dimensions %dx%d", width, height)
+	}
+	interior := math.Float32frombits(binary.LittleEndian.Uint32(hdr[16:20]))
+	paramsLen := binary.LittleEndian.Uint32(hdr[20:24])
+	if paramsLen > maxParamsSize {
+		return nil, fmt.Errorf("envelope: params block of %d bytes exceeds %d", paramsLen, maxParamsSize)
+	}
+
+	pj := make([]byte, paramsLen)
+	if _, err := io.ReadFull(r, pj); err != nil {
+		return nil, fmt.Errorf("envelope: truncated params: %w", err)
+	}
+	var j params
+	if err := json.Unmarshal(pj, &j); err != nil {
+		return nil, fmt.Errorf("envelope: decoding params: %w", err)
+	}
+	p, err := j.toParams()
+	if err != nil {
+		return nil, err
+	}
+	if j.Width != width || j.Height != height {
+		return nil, fmt.Errorf("envelope: params size %dx%d does not match header %dx%d", j.Width, j.Height, width, height)
+	}
+
+	data := make([]float32, width*height)
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		return nil, fmt.Errorf("envelope: truncated data: %w", err)
+	}
+
+	return &Envelope{
+		Version:  int(version),
+		Width:    width,
+		Height:   height,
+		Interior: interior,
+		Params:   p,
+		Data:     data,
+	}, nil
+}
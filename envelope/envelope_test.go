@@ -0,0 +1,185 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func testParams() Params {
+	return Params{
+		Fractal:      "julia",
+		Formula:      "polynomial",
+		Channel:      "smooth",
+		MinX:         -2,
+		MaxX:         2,
+		MinY:         -1.5,
+		MaxY:         1.5,
+		C:            -0.7 + 0.27015i,
+		Width:        3,
+		Height:       2,
+		MaxIter:      256,
+		EscapeRadius: 2,
+	}
+}
+
+func encoded(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := Encode(&b, testParams(), InteriorSentinel, []float32{-1, 0, 1.5, 2.25, -1, 100}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	buf := []float32{-1, 0, 1.5, 2.25, -1, 100}
+	var b bytes.Buffer
+	if err := Encode(&b, testParams(), InteriorSentinel, buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	env, err := Decode(&b)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if env.Version != Version {
+		t.Errorf("Version = %d, want %d", env.Version, Version)
+	}
+	if env.Width != 3 || env.Height != 2 {
+		t.Errorf("size = %dx%d, want 3x2", env.Width, env.Height)
+	}
+	if env.Interior != InteriorSentinel {
+		t.Errorf("Interior = %v, want %v", env.Interior, InteriorSentinel)
+	}
+	if !reflect.DeepEqual(env.Params, testParams()) {
+		t.Errorf("Params = %+v, want %+v", env.Params, testParams())
+	}
+	if !reflect.DeepEqual(env.Data, buf) {
+		t.Errorf("Data = %v, want %v", env.Data, buf)
+	}
+}
+
+func TestRoundTrip_OptionalFields(t *testing.T) {
+	p := testParams()
+	p.Fractal = "mandelbrot"
+	p.Formula = "rational"
+	p.Channel = "distance"
+	p.Power = 3
+	p.Roots = []complex128{1, -0.5 + 0.8660254037844386i, -0.5 - 0.8660254037844386i}
+	p.P = -0.5 + 0.1i
+	p.Lambda = 0.01 - 0.02i
+	p.PolePower = 3
+	p.Prec = 128
+	minX, _, _ := big.ParseFloat("-0.7436438870371587047521915061147746", 10, 200, big.ToNearestEven)
+	p.Exact = &Viewport{MinX: minX, MaxX: big.NewFloat(2), MinY: big.NewFloat(-1.5), MaxY: big.NewFloat(1.5)}
+	nan := float32(math.NaN())
+	var b bytes.Buffer
+	if err := Encode(&b, p, nan, make([]float32, 6)); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	env, err := Decode(&b)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !math.IsNaN(float64(env.Interior)) {
+		t.Errorf("Interior = %v, want NaN", env.Interior)
+	}
+	if env.Params.Exact == nil || env.Params.Exact.MinX.Cmp(minX) != 0 {
+		t.Fatalf("Exact = %+v, want MinX %s", env.Params.Exact, minX.Text('g', -1))
+	}
+	got, want := env.Params, p
+	got.Exact, want.Exact = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Params = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecode_Defaults(t *testing.T) {
+	// Files written before fractal, formula and channel existed omit them.
+	p := testParams()
+	p.Fractal, p.Formula, p.Channel = "", "", ""
+	var b bytes.Buffer
+	if err := Encode(&b, p, InteriorSentinel, make([]float32, 6)); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	env, err := Decode(&b)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(env.Params, testParams()) {
+		t.Errorf("Params = %+v, want %+v", env.Params, testParams())
+	}
+}
+
+func TestEncode_LengthMismatch(t *testing.T) {
+	var b bytes.Buffer
+	if err := Encode(&b, testParams(), InteriorSentinel, []float32{1, 2, 3}); err == nil {
+		t.Error("Encode with short buffer: err = nil, want error")
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	encodedWith := func(mutate func(*Params)) func([]byte) []byte {
+		return func([]byte) []byte {
+			p := testParams()
+			mutate(&p)
+			var b bytes.Buffer
+			Encode(&b, p, InteriorSentinel, make([]float32, 6))
+			return b.Bytes()
+		}
+	}
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+	}{
+		{"empty input", func(b []byte) []byte { return nil }},
+		{"truncated header", func(b []byte) []byte { return b[:10] }},
+		{"truncated data", func(b []byte) []byte { return b[:len(b)-1] }},
+		{"unsupported version", func(b []byte) []byte {
+			binary.LittleEndian.PutUint16(b[4:6], 99)
+			return b
+		}},
+		{"unsupported dtype", func(b []byte) []byte {
+			binary.LittleEndian.PutUint16(b[6:8], 7)
+			return b
+		}},
+		{"zero width", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[8:12], 0)
+			return b
+		}},
+		{"header size disagrees with params", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[8:12], 2)
+			return b
+		}},
+		{"oversized params block", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[20:24], 1<<30)
+			return b
+		}},
+		{"unknown fractal", encodedWith(func(p *Params) { p.Fractal = "sierpinski" })},
+		{"unknown formula", encodedWith(func(p *Params) { p.Formula = "cubic" })},
+		{"unknown channel", encodedWith(func(p *Params) { p.Channel = "angle" })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(bytes.NewReader(tt.mutate(encoded(t)))); err == nil {
+				t.Error("Decode: err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestDecode_NotEnvelope(t *testing.T) {
+	b := encoded(t)
+	copy(b, "RIFF")
+	if _, err := Decode(bytes.NewReader(b)); !errors.Is(err, ErrNotEnvelope) {
+		t.Errorf("err = %v, want ErrNotEnvelope", err)
+	}
+}
@@ -0,0 +1,241 @@
+// Package accesslog writes one structured log record per HTTP request,
+// tagged with a request ID that is propagated from or returned in the
+// X-Request-ID header. Handlers add the parsed parameters, render time and
+// error message of a request through its context.
+package accesslog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+)
+
+// Header carries the request ID in both directions.
+const Header = "X-Request-ID"
+
+// maxRequestIDLength bounds propagated request IDs.
+const maxRequestIDLength = 128
+
+// entry collects what handlers report about a request.
+type entry struct {
+	id string
+
+	mu     sync.Mutex
+	params *julia.Params
+	render time.Duration
+	errMsg string
+}
+
+type contextKey struct{}
+
+// Middleware logs every request served by next to logger once it has been
+// served. Requests with a valid X-Request-ID keep it; others get a new
+// random ID. Either way the ID is set on the response.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(Header)
+		if !validID(id) {
+			id = newID()
+		}
+		e := &entry{id: id}
+		w.Header().Set(Header, id)
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), contextKey{}, e)))
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+		}
+		e.mu.Lock()
+		if e.params != nil {
+			attrs = append(attrs, paramsAttr(*e.params))
+		}
+		if e.render > 0 {
+			attrs = append(attrs, slog.Duration("render_duration", e.render))
+		}
+		if e.errMsg != "" {
+			attrs = append(attrs, slog.String("error", e.errMsg))
+		}
+		e.mu.Unlock()
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside
+// Middleware.
+func RequestID(ctx context.Context) string {
+	if e := fromContext(ctx); e != nil {
+		return e.id
+	}
+	return ""
+}
+
+// SetParams records the parsed parameters of the request.
+func SetParams(ctx context.Context, p julia.Params) {
+	if e := fromContext(ctx); e != nil {
+		e.mu.Lock()
+		e.params = &p
+		e.mu.Unlock()
+	}
+}
+
+// AddRender adds d to the time the request spent rendering.
+func AddRender(ctx context.Context, d time.Duration) {
+	if e := fromContext(ctx); e != nil {
+		e.mu.Lock()
+		e.render += d
+		e.mu.Unlock()
+	}
+}
+
+// SetError records why the request failed.
+func SetError(ctx context.Context, msg string) {
+	if e := fromContext(ctx); e != nil {
+		e.mu.Lock()
+		e.errMsg = msg
+		e.mu.Unlock()
+	}
+}
+
+func fromContext(ctx context.Context) *entry {
+	e, _ := ctx.Value(contextKey{}).(*entry)
+	return e
+}
+
+// paramsAttr returns p as a group, with the exact viewport in place of its
+// float64 approximation for high-precision renders.
+func paramsAttr(p julia.Params) slog.Attr {
+	attrs := []any{
+		slog.String("fractal", p.Fractal.String()),
+		slog.String("formula", p.Formula.String()),
+		slog.String("channel", p.Channel.String()),
+	}
+	if p.Exact != nil {
+		attrs = append(attrs,
+			slog.String("min_x", p.Exact.MinX.Text('g', -1)),
+			slog.String("max_x", p.Exact.MaxX.Text('g', -1)),
+			slog.String("min_y", p.Exact.MinY.Text('g', -1)),
+			slog.String("max_y", p.Exact.MaxY.Text('g', -1)),
+		)
+	} else {
+		attrs = append(attrs,
+			slog.Float64("min_x", p.MinX),
+			slog.Float64("max_x", p.MaxX),
+			slog.Float64("min_y", p.MinY),
+			slog.Float64("max_y", p.MaxY),
+		)
+	}
+	attrs = append(attrs,
+		slog.Float64("c_real", real(p.C)),
+		slog.Float64("c_imag", imag(p.C)),
+		slog.Int("width", p.Width),
+		slog.Int("height", p.Height),
+		slog.Int("max_iter", p.MaxIter),
+		slog.Float64("escape_radius", p.EscapeRadius),
+		slog.Float64("power", p.Degree()),
+		slog.Uint64("precision", uint64(p.Prec)),
+	)
+	if p.Interior != nil {
+		attrs = append(attrs, floatAttr("interior_value", float64(*p.Interior)))
+	}
+	if p.Formula == julia.Phoenix {
+		attrs = append(attrs,
+			slog.Float64("p_real", real(p.P)),
+			slog.Float64("p_imag", imag(p.P)),
+		)
+	}
+	if p.Formula == julia.Rational {
+		attrs = append(attrs,
+			slog.Float64("lambda_real", real(p.Lambda)),
+			slog.Float64("lambda_imag", imag(p.Lambda)),
+			slog.Int("pole_power", p.PoleDegree()),
+		)
+	}
+	if len(p.Roots) > 0 {
+		roots := make([]string, len(p.Roots))
+		for i, r := range p.Roots {
+			roots[i] = strconv.FormatFloat(real(r), 'g', -1, 64) + "," + strconv.FormatFloat(imag(r), 'g', -1, 64)
+		}
+		attrs = append(attrs, slog.Any("roots", roots))
+	}
+	return slog.Group("params", attrs...)
+}
+
+// floatAttr returns v as a number, or as a string such as "NaN" or
+// "+Inf" if it is not finite, which JSON cannot represent.
+func floatAttr(key string, v float64) slog.Attr {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return slog.String(key, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return slog.Float64(key, v)
+}
+
+// validID reports whether a client-supplied request ID is safe to log and
+// echo: non-empty, bounded, and printable ASCII without spaces.
+func validID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newID returns a random 128-bit request ID in hex.
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// recorder captures the status and body size of a response.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
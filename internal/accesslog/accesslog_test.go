@@ -0,0 +1,180 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+)
+
+// serve runs h behind Middleware and returns the response and the decoded
+// log record.
+func serve(t *testing.T, h http.HandlerFunc, req *http.Request) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, nil))
+	w := httptest.NewRecorder()
+	Middleware(logger, h).ServeHTTP(w, req)
+
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("log output %q is not one JSON record: %v", out.String(), err)
+	}
+	return w, record
+}
+
+func TestMiddleware_Record(t *testing.T) {
+	p := julia.Params{MinX: -2, MaxX: 2, MinY: -1, MaxY: 1, C: -0.7 + 0.27015i, Width: 8, Height: 4, MaxIter: 100, EscapeRadius: 2}
+	w, record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		SetParams(r.Context(), p)
+		AddRender(r.Context(), 2*time.Millisecond)
+		AddRender(r.Context(), 3*time.Millisecond)
+		w.Write([]byte("hello"))
+	}, httptest.NewRequest("GET", "/satori/julia/api?width=8", nil))
+
+	id := w.Header().Get(Header)
+	if len(id) != 32 {
+		t.Errorf("generated %s = %q, want 32 hex digits", Header, id)
+	}
+	want := map[string]any{
+		"msg":             "request",
+		"level":           "INFO",
+		"request_id":      id,
+		"method":          "GET",
+		"path":            "/satori/julia/api",
+		"status":          float64(200),
+		"bytes":           float64(5),
+		"render_duration": float64(5 * time.Millisecond),
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("%s = %v, want %v", k, record[k], v)
+		}
+	}
+	params, _ := record["params"].(map[string]any)
+	if params["width"] != float64(8) || params["c_imag"] != 0.27015 || params["fractal"] != "julia" {
+		t.Errorf("params = %v, want the parameters set by the handler", params)
+	}
+	if _, ok := record["error"]; ok {
+		t.Errorf("error = %v, want none", record["error"])
+	}
+}
+
+func TestMiddleware_Error(t *testing.T) {
+	_, record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		SetError(r.Context(), "missing required parameter: max_x")
+		http.Error(w, "bad", http.StatusBadRequest)
+	}, httptest.NewRequest("GET", "/", nil))
+
+	if record["level"] != "WARN" || record["status"] != float64(400) || record["error"] != "missing required parameter: max_x" {
+		t.Errorf("record = %v, want a WARN with status 400 and the error", record)
+	}
+	if _, ok := record["params"]; ok {
+		t.Error("params logged although none were set")
+	}
+}
+
+func TestMiddleware_ServerErrorLevel(t *testing.T) {
+	_, record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, httptest.NewRequest("GET", "/", nil))
+
+	if record["level"] != "ERROR" {
+		t.Errorf("level = %v, want ERROR", record["level"])
+	}
+}
+
+func TestMiddleware_RequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		propagate bool
+	}{
+		{"propagated", "abc-123", true},
+		{"empty", "", false},
+		{"spaces", "abc 123", false},
+		{"control characters", "abc\x01", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(Header, tt.header)
+			var seen string
+			w, record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+			}, req)
+
+			id := w.Header().Get(Header)
+			if got := id == tt.header; got != tt.propagate {
+				t.Errorf("response ID = %q for header %q, propagated = %v, want %v", id, tt.header, got, tt.propagate)
+			}
+			if seen != id || record["request_id"] != id {
+				t.Errorf("handler saw %q and log has %v, want both %q", seen, record["request_id"], id)
+			}
+		})
+	}
+}
+
+func TestParamsAttr_ExactViewport(t *testing.T) {
+	minX, _, _ := big.ParseFloat("-0.743643887037158704752191506114774", 10, 128, big.ToNearestEven)
+	p := julia.Params{
+		MinX: -0.75, MaxX: -0.74, Prec: 128,
+		Exact: &julia.Viewport{MinX: minX, MaxX: big.NewFloat(-0.74), MinY: big.NewFloat(0.1), MaxY: big.NewFloat(0.2)},
+	}
+	got := paramsAttr(p).Value.Group()
+	for _, a := range got {
+		if a.Key == "min_x" {
+			if s := a.Value.String(); !strings.HasPrefix(s, "-0.74364388703715870475") {
+				t.Errorf("min_x = %s, want the exact viewport", s)
+			}
+			return
+		}
+	}
+	t.Error("min_x missing from params")
+}
+
+func TestMiddleware_NonFiniteInterior(t *testing.T) {
+	tests := []struct {
+		value float32
+		want  any
+	}{
+		{float32(math.NaN()), "NaN"},
+		{float32(math.Inf(1)), "+Inf"},
+		{float32(math.Inf(-1)), "-Inf"},
+		{0.5, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.want), func(t *testing.T) {
+			v := tt.value
+			_, record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+				SetParams(r.Context(), julia.Params{Width: 1, Height: 1, Interior: &v})
+			}, httptest.NewRequest("GET", "/", nil))
+
+			params, _ := record["params"].(map[string]any)
+			if got := params["interior_value"]; got != tt.want {
+				t.Errorf("interior_value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestID_OutsideMiddleware(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if id := RequestID(req.Context()); id != "" {
+		t.Errorf("RequestID = %q, want empty", id)
+	}
+	// Annotations outside Middleware are ignored.
+	SetParams(req.Context(), julia.Params{})
+	SetError(req.Context(), "x")
+	AddRender(req.Context(), time.Second)
+}
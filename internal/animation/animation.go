@@ -0,0 +1,78 @@
+// Package animation renders Julia sets as their constant c moves along a
+// path, as frames of an animated GIF.
+package animation
+
+import (
+	"context"
+	"image"
+	"image/gif"
+	"math"
+	"math/cmplx"
+
+	"github.com/kqnade/julia-web-server/internal/colorize"
+	"github.com/kqnade/julia-web-server/internal/julia"
+)
+
+// Circle returns n values of c evenly spaced around the circle with the
+// given centre and radius, starting at centre + radius. The last value
+// stops one step short of the first, so the animation loops seamlessly.
+func Circle(center complex128, radius float64, n int) []complex128 {
+	cs := make([]complex128, n)
+	for k := range cs {
+		theta := 2 * math.Pi * float64(k) / float64(n)
+		cs[k] = center + cmplx.Rect(radius, theta)
+	}
+	return cs
+}
+
+// Line returns n >= 2 values of c evenly spaced from from to to, inclusive.
+func Line(from, to complex128, n int) []complex128 {
+	return Keyframes([]complex128{from, to}, n)
+}
+
+// Keyframes returns n >= 2 values of c along the polyline through points,
+// from the first point to the last. Each segment between consecutive
+// points takes an equal share of the frames.
+func Keyframes(points []complex128, n int) []complex128 {
+	cs := make([]complex128, n)
+	segments := len(points) - 1
+	for k := range cs {
+		t := float64(k) / float64(n-1) * float64(segments)
+		i := min(int(t), segments-1)
+		f := complex(t-float64(i), 0)
+		cs[k] = points[i] + (points[i+1]-points[i])*f
+	}
+	return cs
+}
+
+// GIF renders one frame of p for each value of c in cs and returns them as
+// a GIF that loops forever, showing each frame for delay hundredths of a
+// second. Frames are colored like colorize.Image, or colorize.DistanceImage
+// for the distance channel, quantized to a 256-colour palette.
+//
+// Frames are rendered one after another with render, such as
+// renderer.Render, and the first error it returns is returned.
+func GIF(ctx context.Context, p julia.Params, cs []complex128, delay int, render func(context.Context, julia.Params) ([]float32, error)) (*gif.GIF, error) {
+	// Coloring finds interior points by the default sentinel.
+	p.Interior = nil
+	spacing := p.PixelSpacing()
+
+	anim := &gif.GIF{
+		Image: make([]*image.Paletted, len(cs)),
+		Delay: make([]int, len(cs)),
+	}
+	for k, c := range cs {
+		p.C = c
+		buf, err := render(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if p.Channel == julia.Distance {
+			anim.Image[k] = colorize.DistancePaletted(buf, p.Width, p.Height, spacing)
+		} else {
+			anim.Image[k] = colorize.Paletted(buf, p.Width, p.Height)
+		}
+		anim.Delay[k] = delay
+	}
+	return anim, nil
+}
@@ -0,0 +1,87 @@
+package animation
+
+import (
+	"context"
+	"math/cmplx"
+	"testing"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+	"github.com/kqnade/julia-web-server/internal/renderer"
+)
+
+func near(a, b complex128) bool {
+	return cmplx.Abs(a-b) < 1e-12
+}
+
+func TestCircle(t *testing.T) {
+	cs := Circle(-0.5, 0.25, 4)
+	want := []complex128{-0.25, -0.5 + 0.25i, -0.75, -0.5 - 0.25i}
+	for k := range want {
+		if !near(cs[k], want[k]) {
+			t.Errorf("Circle[%d] = %v, want %v", k, cs[k], want[k])
+		}
+	}
+}
+
+func TestLine(t *testing.T) {
+	cs := Line(0, 1+2i, 3)
+	want := []complex128{0, 0.5 + 1i, 1 + 2i}
+	for k := range want {
+		if !near(cs[k], want[k]) {
+			t.Errorf("Line[%d] = %v, want %v", k, cs[k], want[k])
+		}
+	}
+}
+
+func TestKeyframes(t *testing.T) {
+	cs := Keyframes([]complex128{0, 1, 1 + 1i}, 5)
+	want := []complex128{0, 0.5, 1, 1 + 0.5i, 1 + 1i}
+	for k := range want {
+		if !near(cs[k], want[k]) {
+			t.Errorf("Keyframes[%d] = %v, want %v", k, cs[k], want[k])
+		}
+	}
+}
+
+func TestGIF(t *testing.T) {
+	p := julia.Params{
+		MinX: -2, MaxX: 2, MinY: -1.5, MaxY: 1.5,
+		Width: 16, Height: 12,
+		MaxIter:      64,
+		EscapeRadius: julia.DefaultEscapeRadius,
+	}
+	cs := Line(-0.8, 0.3+0.5i, 4)
+	anim, err := GIF(context.Background(), p, cs, 7, renderer.Render)
+	if err != nil {
+		t.Fatalf("GIF: %v", err)
+	}
+	if len(anim.Image) != 4 || len(anim.Delay) != 4 {
+		t.Fatalf("got %d frames and %d delays, want 4", len(anim.Image), len(anim.Delay))
+	}
+	for k, img := range anim.Image {
+		if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 12 {
+			t.Errorf("frame %d is %dx%d, want 16x12", k, b.Dx(), b.Dy())
+		}
+		if anim.Delay[k] != 7 {
+			t.Errorf("frame %d delay = %d, want 7", k, anim.Delay[k])
+		}
+	}
+	// c moves, so the first and last frames differ.
+	first, last := anim.Image[0].Pix, anim.Image[3].Pix
+	same := true
+	for i := range first {
+		same = same && first[i] == last[i]
+	}
+	if same {
+		t.Error("first and last frames are identical")
+	}
+}
+
+func TestGIF_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := julia.Params{MinX: -2, MaxX: 2, MinY: -2, MaxY: 2, Width: 8, Height: 8, MaxIter: 16, EscapeRadius: 2}
+	if _, err := GIF(ctx, p, Circle(0, 0.7, 3), 5, renderer.Render); err == nil {
+		t.Error("GIF succeeded with a cancelled context")
+	}
+}
@@ -0,0 +1,160 @@
+// Package cache provides a byte-bounded LRU cache of rendered buffers that
+// coalesces concurrent requests for the same key into a single render.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// RenderFunc produces the buffer for a key on a cache miss.
+type RenderFunc func(ctx context.Context) ([]float32, error)
+
+// Stats is a snapshot of cache counters.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Coalesced uint64 `json:"coalesced"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"max_bytes"`
+}
+
+// Cache is safe for concurrent use. Buffers returned by Get are shared
+// between callers and must not be modified.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	ll       *list.List // front is most recently used
+	items    map[string]*list.Element
+	calls    map[string]*call
+
+	hits, misses, coalesced uint64
+}
+
+type entry struct {
+	key string
+	buf []float32
+}
+
+// call is a render in flight, shared by every caller waiting on its key.
+type call struct {
+	done    chan struct{}
+	buf     []float32
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// New returns a cache holding at most maxBytes of buffer data. With
+// maxBytes <= 0 nothing is retained, but concurrent requests are still
+// coalesced.
+func New(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		calls:    make(map[string]*call),
+	}
+}
+
+// Get returns the buffer for key, calling render on a miss. Concurrent Gets
+// for a key that is being rendered wait for that render instead of starting
+// another. The render keeps running while at least one caller still waits
+// for it and is cancelled once they have all gone. hit reports whether the
+// buffer was served from the cache without waiting for a render.
+func (c *Cache) Get(ctx context.Context, key string, render RenderFunc) (buf []float32, hit bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		c.hits++
+		c.mu.Unlock()
+		return el.Value.(*entry).buf, true, nil
+	}
+	cl, ok := c.calls[key]
+	if ok {
+		c.coalesced++
+	} else {
+		c.misses++
+		// The render outlives any single caller, so it only inherits values.
+		rctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		cl = &call{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = cl
+		go c.run(rctx, key, cl, render)
+	}
+	cl.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.buf, false, cl.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		cl.waiters--
+		if cl.waiters == 0 {
+			cl.cancel()
+			// Later callers must not join a cancelled render.
+			if c.calls[key] == cl {
+				delete(c.calls, key)
+			}
+		}
+		c.mu.Unlock()
+		return nil, false, ctx.Err()
+	}
+}
+
+func (c *Cache) run(ctx context.Context, key string, cl *call, render RenderFunc) {
+	buf, err := render(ctx)
+	cl.cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls[key] == cl {
+		delete(c.calls, key)
+	}
+	cl.buf, cl.err = buf, err
+	close(cl.done)
+	if err == nil {
+		c.addLocked(key, buf)
+	}
+}
+
+func (c *Cache) addLocked(key string, buf []float32) {
+	size := int64(len(buf)) * 4
+	if size > c.maxBytes {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, buf: buf})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		el := c.ll.Back()
+		e := el.Value.(*entry)
+		c.ll.Remove(el)
+		delete(c.items, e.key)
+		c.bytes -= int64(len(e.buf)) * 4
+	}
+}
+
+// Stats returns the current counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Coalesced: c.coalesced,
+		Entries:   c.ll.Len(),
+		Bytes:     c.bytes,
+		MaxBytes:  c.maxBytes,
+	}
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// constant returns a RenderFunc that yields a buffer of n copies of v and
+// counts its invocations.
+func constant(n int, v float32, calls *atomic.Int32) RenderFunc {
+	return func(context.Context) ([]float32, error) {
+		calls.Add(1)
+		buf := make([]float32, n)
+		for i := range buf {
+			buf[i] = v
+		}
+		return buf, nil
+	}
+}
+
+func TestGet_HitAfterMiss(t *testing.T) {
+	c := New(1 << 20)
+	var calls atomic.Int32
+
+	buf, hit, err := c.Get(context.Background(), "k", constant(4, 1, &calls))
+	if err != nil || hit || len(buf) != 4 {
+		t.Fatalf("first Get = (%v, %v, %v), want 4 values, miss, nil", buf, hit, err)
+	}
+	buf, hit, err = c.Get(context.Background(), "k", constant(4, 2, &calls))
+	if err != nil || !hit || buf[0] != 1 {
+		t.Fatalf("second Get = (%v, %v, %v), want cached values, hit, nil", buf, hit, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("render called %d times, want 1", n)
+	}
+
+	s := c.Stats()
+	if s.Hits != 1 || s.Misses != 1 || s.Entries != 1 || s.Bytes != 16 {
+		t.Errorf("Stats = %+v, want 1 hit, 1 miss, 1 entry, 16 bytes", s)
+	}
+}
+
+func TestGet_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(32) // room for two 4-value buffers
+	var calls atomic.Int32
+	ctx := context.Background()
+
+	c.Get(ctx, "a", constant(4, 1, &calls))
+	c.Get(ctx, "b", constant(4, 2, &calls))
+	c.Get(ctx, "a", constant(4, 1, &calls)) // a is now most recent
+	c.Get(ctx, "c", constant(4, 3, &calls)) // evicts b
+
+	if _, hit, _ := c.Get(ctx, "a", constant(4, 1, &calls)); !hit {
+		t.Error("a was evicted, want it retained")
+	}
+	if _, hit, _ := c.Get(ctx, "b", constant(4, 2, &calls)); hit {
+		t.Error("b was retained, want it evicted")
+	}
+	if s := c.Stats(); s.Bytes > 32 {
+		t.Errorf("Bytes = %d, want <= 32", s.Bytes)
+	}
+}
+
+func TestGet_OversizedNotRetained(t *testing.T) {
+	c := New(8)
+	var calls atomic.Int32
+
+	c.Get(context.Background(), "big", constant(4, 1, &calls))
+	c.Get(context.Background(), "big", constant(4, 1, &calls))
+	if n := calls.Load(); n != 2 {
+		t.Errorf("render called %d times, want 2", n)
+	}
+	if s := c.Stats(); s.Entries != 0 {
+		t.Errorf("Entries = %d, want 0", s.Entries)
+	}
+}
+
+func TestGet_ErrorsNotCached(t *testing.T) {
+	c := New(1 << 20)
+	boom := errors.New("boom")
+
+	_, _, err := c.Get(context.Background(), "k", func(context.Context) ([]float32, error) { return nil, boom })
+	if !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	var calls atomic.Int32
+	if _, hit, err := c.Get(context.Background(), "k", constant(1, 1, &calls)); hit || err != nil {
+		t.Errorf("Get after error = (hit %v, %v), want miss, nil", hit, err)
+	}
+}
+
+func TestGet_CoalescesConcurrentRequests(t *testing.T) {
+	c := New(1 << 20)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	render := func(context.Context) ([]float32, error) {
+		calls.Add(1)
+		<-release
+		return []float32{7}, nil
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	results := make([][]float32, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = c.Get(context.Background(), "k", render)
+		}(i)
+	}
+	// Wait until every caller has joined the in-flight render.
+	for {
+		c.mu.Lock()
+		cl := c.calls["k"]
+		joined := cl != nil && cl.waiters == n
+		c.mu.Unlock()
+		if joined {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("render called %d times, want 1", got)
+	}
+	for i, r := range results {
+		if len(r) != 1 || r[0] != 7 {
+			t.Errorf("result %d = %v, want [7]", i, r)
+		}
+	}
+	if s := c.Stats(); s.Misses != 1 || s.Coalesced != n-1 {
+		t.Errorf("Stats = %+v, want 1 miss and %d coalesced", s, n-1)
+	}
+}
+
+func TestGet_CancelsRenderWhenAllCallersLeave(t *testing.T) {
+	c := New(1 << 20)
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	render := func(ctx context.Context) ([]float32, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, _, err := c.Get(ctx, "k", render); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("render context err = %v, want context.Canceled", err)
+	}
+}
+
+func TestGet_CancelledContext(t *testing.T) {
+	c := New(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := c.Get(ctx, "k", func(context.Context) ([]float32, error) {
+		t.Error("render called for cancelled context")
+		return nil, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
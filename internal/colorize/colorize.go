@@ -0,0 +1,186 @@
+package colorize
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Smooth returns the color for a smooth iteration count as produced by
+// renderer.Render. Escaped points (>= 0) are colored with
+// hue = (smooth * 10) mod 360 at full saturation and value; interior
+// points (< 0) are black.
+func Smooth(smooth float32) color.RGBA {
+	if smooth < 0 {
+		return color.RGBA{A: 255}
+	}
+	hue := math.Mod(float64(smooth)*10, 360)
+	r, g, b := HSVToRGB(hue, 1.0, 1.0)
+	return color.RGBA{R: r, G: g, B: b, A: 255}
+}
+
+// Image colors a row-major smooth iteration buffer of the given dimensions.
+// len(buf) must be width*height.
+func Image(buf []float32, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, v := range buf {
+		c := Smooth(v)
+		off := i * 4
+		img.Pix[off] = c.R
+		img.Pix[off+1] = c.G
+		img.Pix[off+2] = c.B
+		img.Pix[off+3] = c.A
+	}
+	return img
+}
+
+// distanceRamp is the distance, in pixels, over which Distance fades from
+// black at the boundary to white.
+const distanceRamp = 2.0
+
+// Distance returns the grey level for a distance estimate dist as produced
+// by renderer.Render, for pixels pixelSize apart. Points on the boundary
+// are black and fade to white within distanceRamp pixels of it, so lines
+// stay about as thin at every zoom; interior points (< 0) are black.
+func Distance(dist float32, pixelSize float64) color.RGBA {
+	if dist < 0 {
+		return color.RGBA{A: 255}
+	}
+	t := math.Min(float64(dist)/(pixelSize*distanceRamp), 1)
+	g := toByte(math.Sqrt(t))
+	return color.RGBA{R: g, G: g, B: g, A: 255}
+}
+
+// DistanceImage colors a row-major distance buffer of the given dimensions
+// with Distance. len(buf) must be width*height.
+func DistanceImage(buf []float32, width, height int, pixelSize float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, v := range buf {
+		c := Distance(v, pixelSize)
+		off := i * 4
+		img.Pix[off] = c.R
+		img.Pix[off+1] = c.G
+		img.Pix[off+2] = c.B
+		img.Pix[off+3] = c.A
+	}
+	return img
+}
+
+// Newton shading: each iteration taken to converge darkens a pixel by
+// newtonFade, down to newtonMinValue.
+const (
+	newtonFade     = 0.9
+	newtonMinValue = 0.2
+)
+
+// Newton returns the color for a Newton value as produced by
+// renderer.Render for julia.Newton with the given number of roots and
+// maxIter: root index plus smooth convergence count / maxIter. Each root
+// gets its own hue, darker the longer the point took to converge; points
+// that did not converge (< 0) are black.
+func Newton(v float32, roots, maxIter int) color.RGBA {
+	if v < 0 || roots < 1 {
+		return color.RGBA{A: 255}
+	}
+	root := math.Floor(float64(v))
+	smooth := (float64(v) - root) * float64(maxIter)
+	hue := math.Mod(root*360/float64(roots), 360)
+	value := math.Max(newtonMinValue, math.Pow(newtonFade, smooth))
+	r, g, b := HSVToRGB(hue, 1.0, value)
+	return color.RGBA{R: r, G: g, B: b, A: 255}
+}
+
+// NewtonImage colors a row-major Newton buffer of the given dimensions
+// with Newton. len(buf) must be width*height.
+func NewtonImage(buf []float32, width, height, roots, maxIter int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, v := range buf {
+		c := Newton(v, roots, maxIter)
+		off := i * 4
+		img.Pix[off] = c.R
+		img.Pix[off+1] = c.G
+		img.Pix[off+2] = c.B
+		img.Pix[off+3] = c.A
+	}
+	return img
+}
+
+// hueSteps is the number of hues in HuePalette.
+const hueSteps = 255
+
+// HuePalette returns a 256-colour palette for Smooth: black, for interior
+// points, followed by hueSteps evenly spaced hues at full saturation and
+// value.
+func HuePalette() color.Palette {
+	pal := make(color.Palette, 0, 1+hueSteps)
+	pal = append(pal, color.RGBA{A: 255})
+	for i := 0; i < hueSteps; i++ {
+		r, g, b := HSVToRGB(float64(i)*360/hueSteps, 1.0, 1.0)
+		pal = append(pal, color.RGBA{R: r, G: g, B: b, A: 255})
+	}
+	return pal
+}
+
+// GreyPalette returns the 256 grey levels used by Distance.
+func GreyPalette() color.Palette {
+	pal := make(color.Palette, 256)
+	for i := range pal {
+		pal[i] = color.RGBA{R: uint8(i), G: uint8(i), B: uint8(i), A: 255}
+	}
+	return pal
+}
+
+// Paletted colors a smooth iteration buffer like Image, quantized onto
+// HuePalette by rounding each hue to the nearest palette hue.
+func Paletted(buf []float32, width, height int) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), HuePalette())
+	for i, v := range buf {
+		if v < 0 {
+			continue // index 0 is black
+		}
+		hue := math.Mod(float64(v)*10, 360)
+		img.Pix[i] = uint8(1 + int(math.Floor(hue*hueSteps/360+0.5))%hueSteps)
+	}
+	return img
+}
+
+// DistancePaletted colors a distance buffer like DistanceImage, on
+// GreyPalette.
+func DistancePaletted(buf []float32, width, height int, pixelSize float64) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), GreyPalette())
+	for i, v := range buf {
+		img.Pix[i] = Distance(v, pixelSize).R
+	}
+	return img
+}
+
+// HSVToRGB converts HSV to RGB. h is in [0,360), s and v are in [0,1].
+// Each returned component is in [0,255].
+func HSVToRGB(h, s, v float64) (r, g, b uint8) {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+
+	return toByte(rf + m), toByte(gf + m), toByte(bf + m)
+}
+
+// toByte scales a [0,1] component to [0,255], rounding half up.
+func toByte(f float64) uint8 {
+	return uint8(math.Floor(f*255 + 0.5))
+}
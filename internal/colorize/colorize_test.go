@@ -0,0 +1,170 @@
+package colorize
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestHSVToRGB(t *testing.T) {
+	tests := []struct {
+		name    string
+		h, s, v float64
+		want    [3]uint8
+	}{
+		{"red", 0, 1, 1, [3]uint8{255, 0, 0}},
+		{"yellow", 60, 1, 1, [3]uint8{255, 255, 0}},
+		{"green", 120, 1, 1, [3]uint8{0, 255, 0}},
+		{"cyan", 180, 1, 1, [3]uint8{0, 255, 255}},
+		{"blue", 240, 1, 1, [3]uint8{0, 0, 255}},
+		{"magenta", 300, 1, 1, [3]uint8{255, 0, 255}},
+		{"orange rounds half up", 30, 1, 1, [3]uint8{255, 128, 0}},
+		{"zero value is black", 90, 1, 0, [3]uint8{0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, g, b := HSVToRGB(tt.h, tt.s, tt.v)
+			if got := [3]uint8{r, g, b}; got != tt.want {
+				t.Errorf("HSVToRGB(%v, %v, %v) = %v, want %v", tt.h, tt.s, tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	tests := []struct {
+		name   string
+		smooth float32
+		want   color.RGBA
+	}{
+		{"interior is black", -1, color.RGBA{0, 0, 0, 255}},
+		{"zero is red", 0, color.RGBA{255, 0, 0, 255}},
+		{"hue wraps at 360", 36, color.RGBA{255, 0, 0, 255}},
+		{"smooth 12 is green", 12, color.RGBA{0, 255, 0, 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Smooth(tt.smooth); got != tt.want {
+				t.Errorf("Smooth(%v) = %v, want %v", tt.smooth, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		dist float32
+		want uint8
+	}{
+		{"interior is black", -1, 0},
+		{"boundary is black", 0, 0},
+		{"half a ramp", 1, 180},
+		{"full ramp is white", 2, 255},
+		{"far is white", 100, 255},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := color.RGBA{tt.want, tt.want, tt.want, 255}
+			if got := Distance(tt.dist, 1); got != want {
+				t.Errorf("Distance(%v, 1) = %v, want %v", tt.dist, got, want)
+			}
+		})
+	}
+}
+
+func TestDistanceImage(t *testing.T) {
+	buf := []float32{-1, 0, 0.01, 0.02, 1, -1}
+	img := DistanceImage(buf, 3, 2, 0.01)
+
+	if b := img.Bounds(); b.Dx() != 3 || b.Dy() != 2 {
+		t.Fatalf("bounds = %v, want 3x2", b)
+	}
+	for i, v := range buf {
+		x, y := i%3, i/3
+		if got, want := img.RGBAAt(x, y), Distance(v, 0.01); got != want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+		}
+	}
+}
+
+func TestNewton(t *testing.T) {
+	tests := []struct {
+		name string
+		v    float32
+		want color.RGBA
+	}{
+		{"not converged is black", -1, color.RGBA{A: 255}},
+		{"root 0 at once is red", 0, color.RGBA{255, 0, 0, 255}},
+		{"root 1 of 3 is green", 1, color.RGBA{0, 255, 0, 255}},
+		{"root 2 of 3 is blue", 2, color.RGBA{0, 0, 255, 255}},
+		// 10 of 100 iterations: 0.9^10 of full value
+		{"slow convergence is darker", 1.1, color.RGBA{0, 89, 0, 255}},
+		{"very slow convergence is dim", 0.99, color.RGBA{51, 0, 0, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Newton(tt.v, 3, 100); got != tt.want {
+				t.Errorf("Newton(%v, 3, 100) = %v, want %v", tt.v, got, tt.want)
+			}
+		})
+	}
+
+	buf := []float32{-1, 0, 1.05, 2.5}
+	img := NewtonImage(buf, 2, 2, 3, 100)
+	for i, v := range buf {
+		x, y := i%2, i/2
+		if got, want := img.RGBAAt(x, y), Newton(v, 3, 100); got != want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	buf := []float32{-1, 0, 12, 24, 36, -1}
+	img := Image(buf, 3, 2)
+
+	if b := img.Bounds(); b.Dx() != 3 || b.Dy() != 2 {
+		t.Fatalf("bounds = %v, want 3x2", b)
+	}
+	for i, v := range buf {
+		x, y := i%3, i/3
+		if got, want := img.RGBAAt(x, y), Smooth(v); got != want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+		}
+	}
+}
+
+func TestPaletted(t *testing.T) {
+	// Smooth values 0 and 12 give hues 0 and 120, which are palette colours.
+	buf := []float32{-1, 0, 12, 18.2}
+	img := Paletted(buf, 2, 2)
+
+	if len(img.Palette) != 256 {
+		t.Fatalf("palette has %d colours, want 256", len(img.Palette))
+	}
+	for i, v := range buf[:3] {
+		if got, want := img.At(i%2, i/2), Smooth(v); got != want {
+			t.Errorf("pixel %d = %v, want %v", i, got, want)
+		}
+	}
+	// Other hues round to the nearest palette hue.
+	got := img.At(1, 1).(color.RGBA)
+	want := Smooth(18.2)
+	if d := int(got.G) - int(want.G); got.R != want.R || got.B != want.B || d < -3 || d > 3 {
+		t.Errorf("pixel 3 = %v, want close to %v", got, want)
+	}
+}
+
+func TestDistancePaletted(t *testing.T) {
+	buf := []float32{-1, 0, 0.01, 0.02, 1, -1}
+	img := DistancePaletted(buf, 3, 2, 0.01)
+
+	for i, v := range buf {
+		if got, want := img.At(i%3, i/3), Distance(v, 0.01); got != want {
+			t.Errorf("pixel %d = %v, want %v", i, got, want)
+		}
+	}
+}
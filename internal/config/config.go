@@ -0,0 +1,287 @@
+// Package config assembles the server configuration from built-in
+// defaults, a JSON config file, JULIA_* environment variables and
+// command-line flags, in increasing order of precedence.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/handler"
+	"github.com/kqnade/julia-web-server/internal/renderer"
+)
+
+// EnvPrefix starts the name of every environment variable read by Load.
+const EnvPrefix = "JULIA_"
+
+// Log formats accepted by the log-format option.
+const (
+	LogText = "text"
+	LogJSON = "json"
+)
+
+// Config is the runtime configuration of the server.
+type Config struct {
+	Addr      string
+	BasePath  string // URL prefix of the UI and API, without a trailing slash
+	LogFormat string
+
+	Workers    int
+	QueueDepth int
+	CacheBytes int64
+	MaxJobs    int
+	JobTTL     time.Duration
+
+	Limits handler.Limits
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may run after a
+	// shutdown signal.
+	ShutdownTimeout time.Duration
+}
+
+// Default returns the built-in configuration.
+func Default() Config {
+	return Config{
+		Addr:       ":8080",
+		BasePath:   "/satori/julia",
+		LogFormat:  LogText,
+		Workers:    runtime.NumCPU(),
+		QueueDepth: renderer.DefaultQueueDepth,
+		CacheBytes: handler.DefaultCacheBytes,
+		MaxJobs:    handler.DefaultMaxJobs,
+		JobTTL:     handler.DefaultJobTTL,
+		Limits:     handler.DefaultLimits,
+
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   time.Minute,
+	}
+}
+
+// option is one setting. Its flag is -name, its environment variable
+// EnvPrefix plus the name in upper case with dashes as underscores, and its
+// config file key the name with dashes as underscores.
+type option struct {
+	name  string
+	usage string
+	field func(c *Config) any // pointer to the field in c
+}
+
+var options = []option{
+	{"addr", "listen address", func(c *Config) any { return &c.Addr }},
+	{"base-path", "URL prefix of the UI and API", func(c *Config) any { return &c.BasePath }},
+	{"log-format", "log output format: text or json", func(c *Config) any { return &c.LogFormat }},
+	{"workers", "number of render worker goroutines", func(c *Config) any { return &c.Workers }},
+	{"queue-depth", "maximum number of renders admitted at once", func(c *Config) any { return &c.QueueDepth }},
+	{"cache-bytes", "maximum size of the tile cache in bytes; negative disables the cache", func(c *Config) any { return &c.CacheBytes }},
+	{"max-jobs", "maximum number of background render jobs held at once", func(c *Config) any { return &c.MaxJobs }},
+	{"job-ttl", "how long finished background jobs are kept", func(c *Config) any { return &c.JobTTL }},
+	{"default-width", "image width when the width parameter is omitted", func(c *Config) any { return &c.Limits.DefaultWidth }},
+	{"default-height", "image height when the height parameter is omitted", func(c *Config) any { return &c.Limits.DefaultHeight }},
+	{"default-max-iter", "iteration limit when the max_iter parameter is omitted", func(c *Config) any { return &c.Limits.DefaultMaxIter }},
+	{"max-dimension", "largest width or height of a render", func(c *Config) any { return &c.Limits.MaxDimension }},
+	{"max-poster-dimension", "largest width or height of a poster", func(c *Config) any { return &c.Limits.MaxPosterDimension }},
+	{"max-iter-limit", "largest accepted max_iter", func(c *Config) any { return &c.Limits.MaxMaxIter }},
+	{"max-animation-pixels", "largest width*height*frames of an animation", func(c *Config) any { return &c.Limits.MaxAnimationPixels }},
+	{"read-header-timeout", "time allowed to read request headers", func(c *Config) any { return &c.ReadHeaderTimeout }},
+	{"read-timeout", "time allowed to read a whole request", func(c *Config) any { return &c.ReadTimeout }},
+	{"write-timeout", "time allowed to write a response, 0 for no limit", func(c *Config) any { return &c.WriteTimeout }},
+	{"idle-timeout", "how long idle keep-alive connections are kept", func(c *Config) any { return &c.IdleTimeout }},
+	{"shutdown-timeout", "how long in-flight requests may finish after SIGINT or SIGTERM", func(c *Config) any { return &c.ShutdownTimeout }},
+}
+
+// Load returns the configuration given by the command-line arguments args
+// (without the program name), the environment as read by getenv, and the
+// JSON config file named by the -config flag or, failing that, the
+// JULIA_CONFIG variable. Each source overrides the ones before it:
+// defaults, file, environment, flags.
+//
+// With -h or -help, Load prints usage to stderr and returns flag.ErrHelp.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	fs := flag.NewFlagSet("julia-web-server", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path of a JSON config file (env "+EnvPrefix+"CONFIG)")
+	flags := Default()
+	for _, o := range options {
+		usage := fmt.Sprintf("%s (env %s)", o.usage, envName(o.name))
+		switch p := o.field(&flags).(type) {
+		case *string:
+			fs.StringVar(p, o.name, *p, usage)
+		case *int:
+			fs.IntVar(p, o.name, *p, usage)
+		case *int64:
+			fs.Int64Var(p, o.name, *p, usage)
+		case *time.Duration:
+			fs.DurationVar(p, o.name, *p, usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	c := Default()
+	path := *configFile
+	if path == "" {
+		path = getenv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return Config{}, err
+		}
+		err = loadFile(&c, f)
+		f.Close()
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, o := range options {
+		if v := getenv(envName(o.name)); v != "" {
+			if err := set(o.field(&c), v); err != nil {
+				return Config{}, fmt.Errorf("%s: %w", envName(o.name), err)
+			}
+		}
+	}
+	// Only flags given on the command line override the other sources. Their
+	// values were checked by Parse and format back to the same value.
+	fs.Visit(func(f *flag.Flag) {
+		if o, ok := lookup(f.Name); ok {
+			set(o.field(&c), f.Value.String())
+		}
+	})
+
+	c.BasePath = strings.TrimRight(c.BasePath, "/")
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// loadFile applies the settings in a JSON object read from r to c. Values
+// are JSON numbers or strings in the flag syntax, so durations are written
+// like "30s". Unknown keys are an error.
+func loadFile(c *Config, r io.Reader) error {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		o, ok := lookup(strings.ReplaceAll(k, "_", "-"))
+		if !ok || strings.Contains(k, "-") {
+			return fmt.Errorf("unknown setting %q", k)
+		}
+		v := raw[k]
+		s := string(bytes.TrimSpace(v))
+		if strings.HasPrefix(s, `"`) {
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+		if err := set(o.field(c), s); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports whether c can be served.
+func (c Config) Validate() error {
+	switch {
+	case c.Addr == "":
+		return errors.New("addr must not be empty")
+	case c.BasePath != "" && !strings.HasPrefix(c.BasePath, "/") || strings.ContainsAny(c.BasePath, " {}?#"):
+		return fmt.Errorf("base-path must start with / and be a plain URL path, got %q", c.BasePath)
+	case c.LogFormat != LogText && c.LogFormat != LogJSON:
+		return fmt.Errorf("log-format must be %s or %s, got %q", LogText, LogJSON, c.LogFormat)
+	case c.Workers < 1:
+		return fmt.Errorf("workers must be at least 1, got %d", c.Workers)
+	case c.QueueDepth < 1:
+		return fmt.Errorf("queue-depth must be at least 1, got %d", c.QueueDepth)
+	case c.CacheBytes == 0:
+		// juliaweb reads a zero size as its default, so 0 cannot mean off.
+		return errors.New("cache-bytes must not be 0; use a negative value to disable the cache")
+	case c.MaxJobs < 1:
+		return fmt.Errorf("max-jobs must be at least 1, got %d", c.MaxJobs)
+	}
+	for _, d := range []struct {
+		name string
+		v    time.Duration
+	}{
+		{"job-ttl", c.JobTTL},
+		{"read-header-timeout", c.ReadHeaderTimeout},
+		{"read-timeout", c.ReadTimeout},
+		{"write-timeout", c.WriteTimeout},
+		{"idle-timeout", c.IdleTimeout},
+		{"shutdown-timeout", c.ShutdownTimeout},
+	} {
+		if d.v < 0 {
+			return fmt.Errorf("%s must not be negative, got %v", d.name, d.v)
+		}
+	}
+	return c.Limits.Validate()
+}
+
+func lookup(name string) (option, bool) {
+	for _, o := range options {
+		if o.name == name {
+			return o, true
+		}
+	}
+	return option{}, false
+}
+
+func envName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// set parses s into the field ptr points to.
+func set(ptr any, s string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = s
+	case *int:
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid integer", s)
+		}
+		*p = v
+	case *int64:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid integer", s)
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid duration", s)
+		}
+		*p = v
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", ptr))
+	}
+	return nil
+}
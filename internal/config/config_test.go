@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv function over vars.
+func env(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+// writeFile writes a config file into a temporary directory.
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	c, err := Load(nil, env(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c != Default() {
+		t.Errorf("Load() = %+v, want defaults %+v", c, Default())
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `{
+		"addr": ":9000",
+		"workers": 3,
+		"queue_depth": 5,
+		"job_ttl": "1h",
+		"max_iter_limit": 20000
+	}`)
+	vars := map[string]string{
+		"JULIA_CONFIG":      path,
+		"JULIA_WORKERS":     "4",
+		"JULIA_QUEUE_DEPTH": "6",
+	}
+	c, err := Load([]string{"-queue-depth", "7"}, env(vars))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if c.Addr != ":9000" || c.JobTTL != time.Hour || c.Limits.MaxMaxIter != 20000 {
+		t.Errorf("file settings not applied: %+v", c)
+	}
+	if c.Workers != 4 {
+		t.Errorf("Workers = %d, want 4 from the environment over the file", c.Workers)
+	}
+	if c.QueueDepth != 7 {
+		t.Errorf("QueueDepth = %d, want 7 from the flag over the environment", c.QueueDepth)
+	}
+	if c.BasePath != Default().BasePath {
+		t.Errorf("BasePath = %q, want the default", c.BasePath)
+	}
+}
+
+func TestLoad_ConfigFlagOverridesEnv(t *testing.T) {
+	path := writeFile(t, `{"addr": ":9001"}`)
+	c, err := Load([]string{"-config", path}, env(map[string]string{"JULIA_CONFIG": "/nonexistent.json"}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.Addr != ":9001" {
+		t.Errorf("Addr = %q, want :9001", c.Addr)
+	}
+}
+
+func TestLoad_FlagSetToDefault(t *testing.T) {
+	// A flag given explicitly wins even when it repeats the default.
+	c, err := Load([]string{"-log-format", "text"}, env(map[string]string{"JULIA_LOG_FORMAT": "json"}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.LogFormat != LogText {
+		t.Errorf("LogFormat = %q, want text", c.LogFormat)
+	}
+}
+
+func TestLoad_BasePath(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"/fractals", "/fractals"},
+		{"/fractals/", "/fractals"},
+		{"/", ""},
+	}
+	for _, tt := range tests {
+		c, err := Load([]string{"-base-path", tt.in}, env(nil))
+		if err != nil {
+			t.Fatalf("Load(%q): %v", tt.in, err)
+		}
+		if c.BasePath != tt.want {
+			t.Errorf("base path %q loaded as %q, want %q", tt.in, c.BasePath, tt.want)
+		}
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		vars    map[string]string
+		file    string
+		wantErr string
+	}{
+		{"bad flag value", []string{"-workers", "many"}, nil, "", "workers"},
+		{"unknown flag", []string{"-colour", "red"}, nil, "", "colour"},
+		{"extra argument", []string{"serve"}, nil, "", "unexpected"},
+		{"bad env value", nil, map[string]string{"JULIA_JOB_TTL": "soon"}, "", "JULIA_JOB_TTL"},
+		{"unknown file key", nil, nil, `{"colour": "red"}`, "colour"},
+		{"dashed file key", nil, nil, `{"base-path": "/x"}`, "base-path"},
+		{"bad file value", nil, nil, `{"max_jobs": "lots"}`, "max_jobs"},
+		{"malformed file", nil, nil, `{"addr":`, "config.json"},
+		{"missing file", []string{"-config", "/nonexistent/config.json"}, nil, "", "nonexistent"},
+		{"log format", []string{"-log-format", "xml"}, nil, "", "log-format"},
+		{"relative base path", []string{"-base-path", "julia"}, nil, "", "base-path"},
+		{"pattern in base path", []string{"-base-path", "/{x}"}, nil, "", "base-path"},
+		{"no workers", []string{"-workers", "0"}, nil, "", "workers"},
+		{"zero cache", []string{"-cache-bytes", "0"}, nil, "", "cache-bytes"},
+		{"negative timeout", []string{"-read-timeout", "-1s"}, nil, "", "read-timeout"},
+		{"default above limit", []string{"-default-width", "5000"}, nil, "", "default width"},
+		{"poster below render limit", []string{"-max-poster-dimension", "100"}, nil, "", "poster"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := tt.vars
+			if tt.file != "" {
+				vars = map[string]string{"JULIA_CONFIG": writeFile(t, tt.file)}
+			}
+			_, err := Load(tt.args, env(vars))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_CacheDisabled(t *testing.T) {
+	c, err := Load([]string{"-cache-bytes", "-1"}, env(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.CacheBytes != -1 {
+		t.Errorf("CacheBytes = %d, want -1", c.CacheBytes)
+	}
+}
+
+func TestLoad_Help(t *testing.T) {
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	if _, err := Load([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Load(-h) err = %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestOptions_EveryFieldOnce(t *testing.T) {
+	// Each option must point at a distinct field.
+	var c Config
+	seen := make(map[any]string)
+	for _, o := range options {
+		p := o.field(&c)
+		if other, ok := seen[p]; ok {
+			t.Errorf("options %s and %s share a field", other, o.name)
+		}
+		seen[p] = o.name
+		if got := envName(o.name); !strings.HasPrefix(got, EnvPrefix) || strings.Contains(got, "-") {
+			t.Errorf("envName(%s) = %s", o.name, got)
+		}
+	}
+}
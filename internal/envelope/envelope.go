@@ -0,0 +1,126 @@
+// Package envelope reads and writes envelopes, the self-describing binary
+// container of the public envelope package, for julia.Params renders.
+package envelope
+
+import (
+	"io"
+	"math"
+
+	"github.com/kqnade/julia-web-server/envelope"
+	"github.com/kqnade/julia-web-server/internal/julia"
+)
+
+// Aliases of the public package.
+const (
+	Version      = envelope.Version
+	DTypeFloat32 = envelope.DTypeFloat32
+	ContentType  = envelope.ContentType
+)
+
+// ErrNotEnvelope is returned by Decode when the input does not start with
+// the envelope magic bytes.
+var ErrNotEnvelope = envelope.ErrNotEnvelope
+
+// Envelope is a decoded buffer together with everything needed to interpret it.
+type Envelope struct {
+	Version  int
+	Width    int
+	Height   int
+	Interior float32
+	Params   julia.Params
+	Data     []float32
+}
+
+func fromViewport(v *julia.Viewport) *envelope.Viewport {
+	if v == nil {
+		return nil
+	}
+	return &envelope.Viewport{MinX: v.MinX, MaxX: v.MaxX, MinY: v.MinY, MaxY: v.MaxY}
+}
+
+func toViewport(v *envelope.Viewport) *julia.Viewport {
+	if v == nil {
+		return nil
+	}
+	return &julia.Viewport{MinX: v.MinX, MaxX: v.MaxX, MinY: v.MinY, MaxY: v.MaxY}
+}
+
+func fromParams(p julia.Params) envelope.Params {
+	return envelope.Params{
+		Fractal:      p.Fractal.String(),
+		Formula:      p.Formula.String(),
+		Channel:      p.Channel.String(),
+		MinX:         p.MinX,
+		MaxX:         p.MaxX,
+		MinY:         p.MinY,
+		MaxY:         p.MaxY,
+		Exact:        fromViewport(p.Exact),
+		C:            p.C,
+		Width:        p.Width,
+		Height:       p.Height,
+		MaxIter:      p.MaxIter,
+		EscapeRadius: p.EscapeRadius,
+		Power:        p.Power,
+		Prec:         p.Prec,
+		Roots:        p.Roots,
+		P:            p.P,
+		Lambda:       p.Lambda,
+		PolePower:    p.PolePower,
+	}
+}
+
+// toParams converts params validated by envelope.Decode, so every name
+// parses.
+func toParams(p envelope.Params) julia.Params {
+	fractal, _ := julia.ParseFractal(p.Fractal)
+	formula, _ := julia.ParseFormula(p.Formula)
+	channel, _ := julia.ParseChannel(p.Channel)
+	return julia.Params{
+		Fractal:      fractal,
+		Formula:      formula,
+		Channel:      channel,
+		MinX:         p.MinX,
+		MaxX:         p.MaxX,
+		MinY:         p.MinY,
+		MaxY:         p.MaxY,
+		C:            p.C,
+		Width:        p.Width,
+		Height:       p.Height,
+		MaxIter:      p.MaxIter,
+		EscapeRadius: p.EscapeRadius,
+		Power:        p.Power,
+		Prec:         p.Prec,
+		Exact:        toViewport(p.Exact),
+		Roots:        p.Roots,
+		P:            p.P,
+		Lambda:       p.Lambda,
+		PolePower:    p.PolePower,
+	}
+}
+
+// Encode writes buf, rendered from p, to w as an envelope.
+// len(buf) must be p.Width*p.Height.
+func Encode(w io.Writer, p julia.Params, buf []float32) error {
+	return envelope.Encode(w, fromParams(p), p.InteriorValue(), buf)
+}
+
+// Decode reads and validates an envelope from r.
+func Decode(r io.Reader) (*Envelope, error) {
+	e, err := envelope.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	p := toParams(e.Params)
+	interior := e.Interior
+	if math.Float32bits(interior) != math.Float32bits(julia.InteriorSentinel) {
+		p.Interior = &interior
+	}
+	return &Envelope{
+		Version:  e.Version,
+		Width:    e.Width,
+		Height:   e.Height,
+		Interior: interior,
+		Params:   p,
+		Data:     e.Data,
+	}, nil
+}
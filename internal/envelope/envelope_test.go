@@ -0,0 +1,132 @@
+package envelope
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+)
+
+func testParams() julia.Params {
+	return julia.Params{
+		MinX:         -2,
+		MaxX:         2,
+		MinY:         -1.5,
+		MaxY:         1.5,
+		C:            -0.7 + 0.27015i,
+		Width:        3,
+		Height:       2,
+		MaxIter:      256,
+		EscapeRadius: julia.DefaultEscapeRadius,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	buf := []float32{-1, 0, 1.5, 2.25, -1, 100}
+	var b bytes.Buffer
+	if err := Encode(&b, testParams(), buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	env, err := Decode(&b)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if env.Version != Version {
+		t.Errorf("Version = %d, want %d", env.Version, Version)
+	}
+	if env.Width != 3 || env.Height != 2 {
+		t.Errorf("size = %dx%d, want 3x2", env.Width, env.Height)
+	}
+	if env.Interior != julia.InteriorSentinel {
+		t.Errorf("Interior = %v, want %v", env.Interior, julia.InteriorSentinel)
+	}
+	if !reflect.DeepEqual(env.Params, testParams()) {
+		t.Errorf("Params = %+v, want %+v", env.Params, testParams())
+	}
+	for i := range buf {
+		if env.Data[i] != buf[i] {
+			t.Errorf("Data[%d] = %v, want %v", i, env.Data[i], buf[i])
+		}
+	}
+}
+
+func TestRoundTrip_OptionalFields(t *testing.T) {
+	p := testParams()
+	p.Fractal = julia.Mandelbrot
+	p.Formula = julia.Newton
+	p.Channel = julia.Distance
+	p.Power = 3
+	p.Roots = []complex128{1, -0.5 + 0.8660254037844386i, -0.5 - 0.8660254037844386i}
+	p.P = -0.5 + 0.1i
+	p.Lambda = 0.01 - 0.02i
+	p.PolePower = 3
+	var b bytes.Buffer
+	if err := Encode(&b, p, make([]float32, 6)); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	env, err := Decode(&b)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(env.Params, p) {
+		t.Errorf("Params = %+v, want %+v", env.Params, p)
+	}
+}
+
+func TestRoundTrip_Interior(t *testing.T) {
+	p := testParams()
+	nan := float32(math.NaN())
+	p.Interior = &nan
+	var b bytes.Buffer
+	if err := Encode(&b, p, []float32{nan, 0, 1, 2, 3, nan}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	env, err := Decode(&b)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !math.IsNaN(float64(env.Interior)) {
+		t.Errorf("Interior = %v, want NaN", env.Interior)
+	}
+	if env.Params.Interior == nil || !math.IsNaN(float64(*env.Params.Interior)) {
+		t.Errorf("Params.Interior = %v, want NaN", env.Params.Interior)
+	}
+	if env.Params.Key() != p.Key() {
+		t.Errorf("decoded key %q differs from encoded key %q", env.Params.Key(), p.Key())
+	}
+}
+
+func TestRoundTrip_Exact(t *testing.T) {
+	p := testParams()
+	p.Prec = 128
+	minX, _, _ := big.ParseFloat("-0.7436438870371587047521915061147746", 10, 200, big.ToNearestEven)
+	p.Exact = julia.ViewportOf(p)
+	p.Exact.MinX = minX
+	var b bytes.Buffer
+	if err := Encode(&b, p, make([]float32, 6)); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	env, err := Decode(&b)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if env.Params.Prec != 128 {
+		t.Errorf("Prec = %d, want 128", env.Params.Prec)
+	}
+	if env.Params.Exact == nil {
+		t.Fatal("Exact = nil, want bounds")
+	}
+	if env.Params.Exact.MinX.Cmp(minX) != 0 {
+		t.Errorf("Exact.MinX = %s, want %s", env.Params.Exact.MinX.Text('g', -1), minX.Text('g', -1))
+	}
+	if env.Params.Key() != p.Key() {
+		t.Errorf("decoded key %q differs from encoded key %q", env.Params.Key(), p.Key())
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"image/gif"
+	"net/http"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/accesslog"
+	"github.com/kqnade/julia-web-server/internal/animation"
+)
+
+// JuliaAnimation handles GET requests for an animated GIF of the Julia set
+// as comp_const moves along a path.
+func (s *Server) JuliaAnimation(w http.ResponseWriter, r *http.Request) {
+	params, cs, delay, perr := s.limits.parseAnimationParams(r.URL.Query())
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+	accesslog.SetParams(r.Context(), params)
+
+	start := time.Now()
+	anim, err := animation.GIF(r.Context(), params, cs, delay, s.renderer.Render)
+	accesslog.AddRender(r.Context(), time.Since(start))
+	if err != nil {
+		writeRenderError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	gif.EncodeAll(w, anim)
+}
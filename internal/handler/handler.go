@@ -1,25 +1,201 @@
 package handler
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"image/png"
+	"math"
 	"net/http"
+	"time"
 
+	"github.com/kqnade/julia-web-server/internal/accesslog"
+	"github.com/kqnade/julia-web-server/internal/cache"
+	"github.com/kqnade/julia-web-server/internal/colorize"
+	"github.com/kqnade/julia-web-server/internal/envelope"
+	"github.com/kqnade/julia-web-server/internal/jobs"
+	"github.com/kqnade/julia-web-server/internal/julia"
+	"github.com/kqnade/julia-web-server/internal/metrics"
+	"github.com/kqnade/julia-web-server/internal/pool"
 	"github.com/kqnade/julia-web-server/internal/renderer"
 )
 
+// DefaultCacheBytes is the size of the default tile cache.
+const DefaultCacheBytes = 256 << 20
+
+// paramErrors counts requests rejected for their parameters.
+var paramErrors = metrics.NewCounterVec("julia_param_errors_total",
+	"Requests rejected for their parameters, by kind: missing, invalid, out_of_range or conflict.", "kind")
+
+// Server serves the API endpoints. Each Server has its own limits, renderer,
+// tile cache and job manager, so several can serve in one process.
+type Server struct {
+	limits   Limits
+	renderer *renderer.Renderer
+	tiles    *cache.Cache
+	jobs     *jobs.Manager
+}
+
+// New returns a Server that validates requests against l, renders with r,
+// caches buffers in tiles and runs background jobs on m. It fails only if l
+// is inconsistent.
+func New(l Limits, r *renderer.Renderer, tiles *cache.Cache, m *jobs.Manager) (*Server, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return &Server{limits: l, renderer: r, tiles: tiles, jobs: m}, nil
+}
+
 // JuliaAPI handles GET requests to compute Julia set tiles.
-func JuliaAPI(w http.ResponseWriter, r *http.Request) {
-	params, errMsg := parseParams(r.URL.Query())
-	if errMsg != "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": errMsg})
+func (s *Server) JuliaAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params, perr := s.limits.parseParams(q)
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+	accesslog.SetParams(r.Context(), params)
+	format, perr := parseFormat(q, formatRaw)
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+	if format == formatPNG {
+		// Interior values do not change PNG output; share one cached buffer.
+		params.Interior = nil
+	}
+
+	buf, ok := s.render(w, r, params)
+	if !ok {
+		return
+	}
+	writeBuffer(w, params, format, buf)
+}
+
+// JuliaTiles handles GET requests for slippy-map tiles addressed as {z}/{x}/{y}.
+// Tiles are PNG unless format=raw is given.
+func (s *Server) JuliaTiles(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params, perr := s.limits.parseTileParams(r.PathValue("z"), r.PathValue("x"), r.PathValue("y"), q)
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+	accesslog.SetParams(r.Context(), params)
+	format, perr := parseFormat(q, formatPNG)
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+	if format == formatPNG {
+		// Interior values do not change PNG output; share one cached buffer.
+		params.Interior = nil
+	}
+
+	// A tile address plus its query string always renders the same bytes.
+	buf, ok := s.render(w, r, params)
+	if !ok {
 		return
 	}
+	w.Header().Set("Cache-Control", "public, max-age=86400, immutable")
+	writeBuffer(w, params, format, buf)
+}
+
+// CacheStats handles GET requests for tile cache counters.
+func (s *Server) CacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.tiles.Stats())
+}
+
+// render renders params for r through the tile cache. If rendering fails it
+// writes the error response, if any, and returns false.
+func (s *Server) render(w http.ResponseWriter, r *http.Request, params julia.Params) ([]float32, bool) {
+	start := time.Now()
+	buf, hit, err := s.tiles.Get(r.Context(), params.Key(), func(ctx context.Context) ([]float32, error) {
+		return s.renderer.Render(ctx, params)
+	})
+	accesslog.AddRender(r.Context(), time.Since(start))
+	if err != nil {
+		writeRenderError(w, r, err)
+		return nil, false
+	}
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	return buf, true
+}
+
+// writeRenderError writes the response for a render of r that failed with
+// err: 503 while the pool is full or closed, 500 for any other failure, and
+// nothing once the client has gone away.
+func writeRenderError(w http.ResponseWriter, r *http.Request, err error) {
+	accesslog.SetError(r.Context(), err.Error())
+	switch {
+	case errors.Is(err, pool.ErrQueueFull):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "server busy: render queue is full")
+	case r.Context().Err() != nil:
+		// The client has gone away; there is nobody to respond to.
+	case errors.Is(err, pool.ErrClosed):
+		writeError(w, http.StatusServiceUnavailable, "server shutting down")
+	default:
+		writeError(w, http.StatusInternalServerError, "render failed: "+err.Error())
+	}
+}
+
+// writeBuffer writes a rendered buffer in the requested output format.
+func writeBuffer(w http.ResponseWriter, p julia.Params, format string, buf []float32) {
+	switch format {
+	case formatPNG:
+		w.Header().Set("Content-Type", "image/png")
+		if p.Interior != nil {
+			buf = withSentinel(buf, *p.Interior)
+		}
+		switch {
+		case p.Formula == julia.Newton:
+			png.Encode(w, colorize.NewtonImage(buf, p.Width, p.Height, len(p.Roots), p.MaxIter))
+		case p.Channel == julia.Distance:
+			png.Encode(w, colorize.DistanceImage(buf, p.Width, p.Height, p.PixelSpacing()))
+		default:
+			png.Encode(w, colorize.Image(buf, p.Width, p.Height))
+		}
+	case formatEnvelope:
+		w.Header().Set("Content-Type", envelope.ContentType)
+		envelope.Encode(w, p, buf)
+	default:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		binary.Write(w, binary.LittleEndian, buf)
+	}
+}
 
-	buf := renderer.Render(params)
+// withSentinel returns a copy of buf with interior points, holding
+// interior, set back to julia.InteriorSentinel for coloring.
+func withSentinel(buf []float32, interior float32) []float32 {
+	isNaN := math.IsNaN(float64(interior))
+	out := make([]float32, len(buf))
+	for i, v := range buf {
+		if v == interior || isNaN && math.IsNaN(float64(v)) {
+			v = julia.InteriorSentinel
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// writeError writes a JSON error body with the given status code.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	binary.Write(w, binary.LittleEndian, buf)
+// writeParamError writes a 400 response for a parameter error of r, counts
+// it by kind and records it in the access log.
+func writeParamError(w http.ResponseWriter, r *http.Request, perr *paramError) {
+	paramErrors.With(perr.kind).Inc()
+	accesslog.SetError(r.Context(), perr.msg)
+	writeError(w, http.StatusBadRequest, perr.msg)
 }
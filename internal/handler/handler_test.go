@@ -1,20 +1,59 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"image/gif"
+	"image/png"
+	"log/slog"
+	"math"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/accesslog"
+	"github.com/kqnade/julia-web-server/internal/cache"
+	"github.com/kqnade/julia-web-server/internal/envelope"
+	"github.com/kqnade/julia-web-server/internal/jobs"
+	"github.com/kqnade/julia-web-server/internal/julia"
+	"github.com/kqnade/julia-web-server/internal/pool"
+	"github.com/kqnade/julia-web-server/internal/renderer"
 )
 
 const validQuery = "min_x=-2&max_x=2&min_y=-1.5&max_y=1.5&comp_const=-0.7,0.27015"
 
+// testWorkers is the pool of srv, shared by tests that only need a Server
+// with other limits, cache or jobs.
+var testWorkers = pool.New(runtime.NumCPU(), renderer.DefaultQueueDepth)
+
+// srv serves the tests that do not need a Server of their own.
+var srv = newServer(DefaultLimits, testWorkers, nil)
+
+// newServer returns a Server with limits l that renders on workers, with a
+// default tile cache and, unless m is given, a default job manager.
+func newServer(l Limits, workers *pool.Pool, m *jobs.Manager) *Server {
+	r := renderer.New(workers)
+	if m == nil {
+		m = jobs.New(DefaultMaxJobs, DefaultJobTTL, r.RenderProgress)
+	}
+	s, err := New(l, r, cache.New(DefaultCacheBytes), m)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
 func TestJuliaAPI_Success(t *testing.T) {
 	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery, nil)
 	w := httptest.NewRecorder()
 
-	JuliaAPI(w, req)
+	srv.JuliaAPI(w, req)
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
@@ -34,7 +73,7 @@ func TestJuliaAPI_CustomSize(t *testing.T) {
 	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=64&height=32", nil)
 	w := httptest.NewRecorder()
 
-	JuliaAPI(w, req)
+	srv.JuliaAPI(w, req)
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusOK {
@@ -46,6 +85,483 @@ func TestJuliaAPI_CustomSize(t *testing.T) {
 	}
 }
 
+func TestJuliaAPI_PNG(t *testing.T) {
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=64&height=32&format=png", nil)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q, want %q", ct, "image/png")
+	}
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 32 {
+		t.Errorf("image size = %dx%d, want 64x32", b.Dx(), b.Dy())
+	}
+}
+
+func TestJuliaAPI_RawFormat(t *testing.T) {
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=8&height=8&format=raw", nil)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	resp := w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/octet-stream")
+	}
+	if w.Body.Len() != 8*8*4 {
+		t.Errorf("body size = %d, want %d", w.Body.Len(), 8*8*4)
+	}
+}
+
+func TestJuliaAPI_Envelope(t *testing.T) {
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=16&height=8&max_iter=100&format=envelope", nil)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	resp := w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != envelope.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, envelope.ContentType)
+	}
+	env, err := envelope.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to decode envelope: %v", err)
+	}
+	if env.Width != 16 || env.Height != 8 || len(env.Data) != 16*8 {
+		t.Errorf("envelope size = %dx%d with %d samples, want 16x8", env.Width, env.Height, len(env.Data))
+	}
+	if env.Params.MaxIter != 100 || env.Params.C != -0.7+0.27015i {
+		t.Errorf("envelope params = %+v, want max_iter 100 and c -0.7+0.27015i", env.Params)
+	}
+}
+
+func TestJuliaAPI_EscapeRadiusAndInterior(t *testing.T) {
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=16&height=8&escape_radius=256&interior_value=NaN&format=envelope", nil)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	if resp := w.Result(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusOK, w.Body.String())
+	}
+	env, err := envelope.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if env.Params.EscapeRadius != 256 {
+		t.Errorf("EscapeRadius = %v, want 256", env.Params.EscapeRadius)
+	}
+	if !math.IsNaN(float64(env.Interior)) {
+		t.Errorf("Interior = %v, want NaN", env.Interior)
+	}
+	for i, v := range env.Data {
+		if v == julia.InteriorSentinel {
+			t.Fatalf("Data[%d] = %v, want interior points as NaN", i, v)
+		}
+	}
+}
+
+func TestJuliaAPI_ClientGone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery, nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	if w.Body.Len() != 0 {
+		t.Errorf("body size = %d, want 0 for an aborted request", w.Body.Len())
+	}
+}
+
+func TestJuliaAPI_QueueFull(t *testing.T) {
+	busy := pool.New(1, 1)
+	t.Cleanup(busy.Close)
+	s := newServer(DefaultLimits, busy, nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go busy.Do(context.Background(), 1, func(int) {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery, nil)
+	w := httptest.NewRecorder()
+
+	s.JuliaAPI(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if ra := resp.Header.Get("Retry-After"); ra == "" {
+		t.Error("Retry-After header missing")
+	}
+}
+
+func TestJuliaAPI_PoolClosed(t *testing.T) {
+	closed := pool.New(1, 1)
+	closed.Close()
+	s := newServer(DefaultLimits, closed, nil)
+
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery, nil)
+	w := httptest.NewRecorder()
+
+	s.JuliaAPI(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body["error"] == "" {
+		t.Errorf("body = %v, %v; want a JSON error", body, err)
+	}
+}
+
+func TestJuliaAPI_DistancePerturbationLimit(t *testing.T) {
+	// 4x4 views at the Mandelbrot cusp 0.25 with a pixel spacing of
+	// 1e-spanExp; perturbation stops at 1e-290.
+	tests := []struct {
+		name       string
+		spanExp    int
+		channel    string
+		wantStatus int
+	}{
+		{"distance above the limit", 280, "distance", http.StatusOK},
+		{"distance below the limit", 300, "distance", http.StatusBadRequest},
+		{"smooth below the limit", 300, "smooth", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The span 4e-spanExp is written out in full so no digit is lost.
+			delta := "0." + strings.Repeat("0", tt.spanExp-1) + "4"
+			maxX := "0.25" + strings.Repeat("0", tt.spanExp-3) + "4"
+			query := "min_x=0.25&max_x=" + maxX + "&min_y=0&max_y=" + delta +
+				"&width=4&height=4&max_iter=64&fractal=mandelbrot&channel=" + tt.channel
+			req := httptest.NewRequest("GET", "/satori/julia/api?"+query+"&format=envelope", nil)
+			w := httptest.NewRecorder()
+
+			srv.JuliaAPI(w, req)
+
+			if got := w.Result().StatusCode; got != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", got, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(w.Body.String(), "channel") {
+					t.Errorf("body = %s, want a channel error", w.Body.String())
+				}
+				return
+			}
+			env, err := envelope.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if env.Params.Prec == 0 {
+				t.Error("precision = float64, want math/big")
+			}
+		})
+	}
+}
+
+func TestJuliaAPI_Cache(t *testing.T) {
+	s := newServer(DefaultLimits, testWorkers, nil)
+
+	query := "/satori/julia/api?" + validQuery + "&width=32&height=32"
+	var bodies [2]string
+	for i, want := range []string{"MISS", "HIT"} {
+		w := httptest.NewRecorder()
+		s.JuliaAPI(w, httptest.NewRequest("GET", query, nil))
+		if got := w.Result().Header.Get("X-Cache"); got != want {
+			t.Errorf("request %d: X-Cache = %q, want %q", i, got, want)
+		}
+		bodies[i] = w.Body.String()
+	}
+	if bodies[0] != bodies[1] {
+		t.Error("cached body differs from rendered body")
+	}
+
+	w := httptest.NewRecorder()
+	s.CacheStats(w, httptest.NewRequest("GET", "/satori/julia/cache", nil))
+	var stats cache.Stats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("stats = %+v, want 1 hit and 1 miss", stats)
+	}
+}
+
+func TestJuliaAPI_Mandelbrot(t *testing.T) {
+	req := httptest.NewRequest("GET", "/satori/julia/api?min_x=-2&max_x=1&min_y=-1.5&max_y=1.5&fractal=mandelbrot&width=16&height=16", nil)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d (comp_const is optional for mandelbrot)", resp.StatusCode, http.StatusOK)
+	}
+	if w.Body.Len() != 16*16*4 {
+		t.Errorf("body size = %d, want %d", w.Body.Len(), 16*16*4)
+	}
+}
+
+func TestJuliaAPI_Formula(t *testing.T) {
+	// The whole Mandelbrot set lies within |c| <= 2, so rows that do not
+	// cross the real axis tell the formulas apart. p is only used by the
+	// phoenix formula.
+	const query = "min_x=-2&max_x=1&min_y=0.1&max_y=1.5&fractal=mandelbrot&width=16&height=16&max_iter=64&p=-0.5,0.1"
+	bodies := make(map[string]string)
+	for _, formula := range []string{"", "polynomial", "burning_ship", "tricorn", "phoenix"} {
+		for _, precision := range []string{"float64", "128"} {
+			req := httptest.NewRequest("GET", "/satori/julia/api?"+query+"&formula="+formula+"&precision="+precision, nil)
+			w := httptest.NewRecorder()
+
+			srv.JuliaAPI(w, req)
+
+			if resp := w.Result(); resp.StatusCode != http.StatusOK {
+				t.Fatalf("formula=%s precision=%s: status = %d, want %d: %s", formula, precision, resp.StatusCode, http.StatusOK, w.Body.String())
+			}
+			if precision == "float64" {
+				bodies[formula] = w.Body.String()
+			}
+		}
+	}
+	if bodies[""] != bodies["polynomial"] {
+		t.Error("formula=polynomial differs from the default")
+	}
+	seen := make(map[string]string)
+	for _, formula := range []string{"polynomial", "burning_ship", "tricorn", "phoenix"} {
+		if other, ok := seen[bodies[formula]]; ok {
+			t.Errorf("formulas %s and %s render the same buffer", other, formula)
+		}
+		seen[bodies[formula]] = formula
+	}
+}
+
+func TestJuliaAPI_Transcendental(t *testing.T) {
+	const view = "min_x=-4&max_x=4&min_y=-4&max_y=4&width=16&height=16&max_iter=64"
+	tests := []struct {
+		name             string
+		query            string
+		wantEscapeRadius float64
+	}{
+		{"exp", view + "&formula=exp&comp_const=0.3,0", julia.TranscendentalEscapeRadius},
+		{"sin", view + "&formula=sin&comp_const=1,0.1", julia.TranscendentalEscapeRadius},
+		{"cos", view + "&formula=cos&comp_const=1,0", julia.TranscendentalEscapeRadius},
+		{"parameter plane", view + "&formula=exp&fractal=mandelbrot", julia.TranscendentalEscapeRadius},
+		{"explicit escape_radius", view + "&formula=sin&comp_const=1,0&escape_radius=10", 10},
+		{"deep zoom falls back to float64", "min_x=0.1&max_x=0.1000000000000000001&min_y=0&max_y=0.0000000000000000001&width=4&height=4&formula=cos&comp_const=1,0", julia.TranscendentalEscapeRadius},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/satori/julia/api?"+tt.query+"&format=envelope", nil)
+			w := httptest.NewRecorder()
+
+			srv.JuliaAPI(w, req)
+
+			if resp := w.Result(); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusOK, w.Body.String())
+			}
+			env, err := envelope.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if env.Params.EscapeRadius != tt.wantEscapeRadius {
+				t.Errorf("escape_radius = %v, want %v", env.Params.EscapeRadius, tt.wantEscapeRadius)
+			}
+			if env.Params.Prec != 0 {
+				t.Errorf("precision = %d, want float64", env.Params.Prec)
+			}
+			for i, v := range env.Data {
+				if v != julia.InteriorSentinel && !(v >= 0 && v <= float32(env.Params.MaxIter)) {
+					t.Fatalf("Data[%d] = %v, want interior or a count in [0, max_iter]", i, v)
+				}
+			}
+		})
+	}
+}
+
+func TestJuliaAPI_Rational(t *testing.T) {
+	const view = "min_x=-2&max_x=2&min_y=-2&max_y=2&width=16&height=16&max_iter=64&formula=rational"
+	tests := []struct {
+		name        string
+		query       string
+		wantLambda  complex128
+		wantPoleDeg int
+	}{
+		{"mcmullen", view + "&comp_const=0,0&lambda=0.01,0", 0.01, 2},
+		{"pole power", view + "&comp_const=0,0&lambda=0.01,0&power=3&pole_power=1", 0.01, 1},
+		{"pole power defaults to power", view + "&comp_const=0,0&lambda=0.01,0&power=3", 0.01, 3},
+		// λ comes from the pixel, so lambda is unused.
+		{"parameter plane", view + "&fractal=mandelbrot&power=3&lambda=5,5", 0, 3},
+		{"deep zoom falls back to float64", "min_x=0.1&max_x=0.1000000000000000001&min_y=0&max_y=0.0000000000000000001&width=4&height=4&formula=rational&comp_const=0,0&lambda=0.01,0", 0.01, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/satori/julia/api?"+tt.query+"&format=envelope", nil)
+			w := httptest.NewRecorder()
+
+			srv.JuliaAPI(w, req)
+
+			if resp := w.Result(); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusOK, w.Body.String())
+			}
+			env, err := envelope.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if env.Params.Lambda != tt.wantLambda || env.Params.PoleDegree() != tt.wantPoleDeg {
+				t.Errorf("lambda, pole degree = %v, %d; want %v, %d", env.Params.Lambda, env.Params.PoleDegree(), tt.wantLambda, tt.wantPoleDeg)
+			}
+			if env.Params.Prec != 0 {
+				t.Errorf("precision = %d, want float64", env.Params.Prec)
+			}
+			for i, v := range env.Data {
+				if v != julia.InteriorSentinel && !(v >= 0 && v <= float32(env.Params.MaxIter)) {
+					t.Fatalf("Data[%d] = %v, want interior or a count in [0, max_iter]", i, v)
+				}
+			}
+		})
+	}
+}
+
+func TestJuliaAPI_Newton(t *testing.T) {
+	const view = "min_x=-2&max_x=2&min_y=-2&max_y=2&width=16&height=16&formula=newton&max_iter=50"
+	tests := []struct {
+		name      string
+		query     string
+		wantRoots int
+		// wantBasins is whether every root's basin shows in the view.
+		wantBasins bool
+	}{
+		{"default roots", view, 3, true},
+		{"roots", view + "&root=1,0&root=-1,0&root=0,1&root=0,-1", 4, true},
+		{"coefficients", view + "&coef=1,0&coef=0,0&coef=0,0&coef=0,0&coef=-1,0", 4, true},
+		{"leading zero coefficients", view + "&coef=0,0&coef=1,0&coef=0,0&coef=-1,0", 2, true},
+		{"comp_const is ignored", view + "&comp_const=0.3,0.5", 3, true},
+		{"deep zoom falls back to float64", "min_x=0.1&max_x=0.1000000000000000001&min_y=0&max_y=0.0000000000000000001&width=4&height=4&formula=newton", 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/satori/julia/api?"+tt.query+"&format=envelope", nil)
+			w := httptest.NewRecorder()
+
+			srv.JuliaAPI(w, req)
+
+			if resp := w.Result(); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusOK, w.Body.String())
+			}
+			env, err := envelope.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if len(env.Params.Roots) != tt.wantRoots {
+				t.Fatalf("roots = %v, want %d", env.Params.Roots, tt.wantRoots)
+			}
+			if env.Params.Prec != 0 {
+				t.Errorf("precision = %d, want float64", env.Params.Prec)
+			}
+			seen := make(map[int]bool)
+			for _, v := range env.Data {
+				if v == julia.InteriorSentinel {
+					continue
+				}
+				root := int(math.Floor(float64(v)))
+				if root < 0 || root >= tt.wantRoots {
+					t.Fatalf("value %v has root index %d, want below %d", v, root, tt.wantRoots)
+				}
+				seen[root] = true
+			}
+			if tt.wantBasins && len(seen) != tt.wantRoots {
+				t.Errorf("pixels converge to %d roots, want %d", len(seen), tt.wantRoots)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+view+"&format=png", nil)
+	w := httptest.NewRecorder()
+	srv.JuliaAPI(w, req)
+	if resp := w.Result(); resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("png: status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if _, err := png.Decode(w.Body); err != nil {
+		t.Errorf("png: %v", err)
+	}
+}
+
+func TestJuliaAPI_Power(t *testing.T) {
+	for _, power := range []string{"3", "2.5"} {
+		req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=8&height=8&power="+power, nil)
+		w := httptest.NewRecorder()
+
+		srv.JuliaAPI(w, req)
+
+		if resp := w.Result(); resp.StatusCode != http.StatusOK {
+			t.Errorf("power=%s: status = %d, want %d", power, resp.StatusCode, http.StatusOK)
+		}
+	}
+}
+
+func TestJuliaAPI_Distance(t *testing.T) {
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=16&height=8&channel=distance&format=envelope", nil)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	if resp := w.Result(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusOK, w.Body.String())
+	}
+	env, err := envelope.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if env.Params.Channel != julia.Distance {
+		t.Errorf("Channel = %v, want %v", env.Params.Channel, julia.Distance)
+	}
+	if env.Params.EscapeRadius != julia.DistanceEscapeRadius {
+		t.Errorf("EscapeRadius = %v, want %v", env.Params.EscapeRadius, julia.DistanceEscapeRadius)
+	}
+}
+
+func TestJuliaAPI_DistancePNG(t *testing.T) {
+	req := httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=16&height=8&channel=distance&format=png", nil)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	if resp := w.Result(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	// Grey levels only: every pixel has equal R, G and B.
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			if r != g || g != bl {
+				t.Fatalf("pixel (%d, %d) = (%d, %d, %d), want grey", x, y, r, g, bl)
+			}
+		}
+	}
+}
+
 func TestJuliaAPI_ValidationErrors(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -75,6 +591,51 @@ func TestJuliaAPI_ValidationErrors(t *testing.T) {
 		{"max_y is NaN", "min_x=-2&max_x=2&min_y=-1.5&max_y=NaN&comp_const=-0.7,0.27015", "max_y"},
 		{"comp_const real is NaN", "min_x=-2&max_x=2&min_y=-1.5&max_y=1.5&comp_const=NaN,0.27015", "comp_const"},
 		{"comp_const imag is Inf", "min_x=-2&max_x=2&min_y=-1.5&max_y=1.5&comp_const=-0.7,+Inf", "comp_const"},
+		{"unknown format", validQuery + "&format=jpeg", "format"},
+		{"unknown fractal", validQuery + "&fractal=newton", "fractal"},
+		{"unknown channel", validQuery + "&channel=normal", "channel"},
+		{"unknown formula", validQuery + "&formula=burning", "formula"},
+		{"distance needs a holomorphic formula", validQuery + "&formula=tricorn&channel=distance", "channel"},
+		{"newton has no distance", validQuery + "&formula=newton&channel=distance", "channel"},
+		{"newton needs the julia plane", validQuery + "&formula=newton&fractal=mandelbrot", "fractal"},
+		{"newton has no big precision", validQuery + "&formula=newton&precision=128", "precision"},
+		{"newton with one root", validQuery + "&formula=newton&root=1,0", "root"},
+		{"newton with too many roots", validQuery + "&formula=newton" + strings.Repeat("&root=1,0", 17), "root"},
+		{"newton root invalid", validQuery + "&formula=newton&root=1,0&root=x,0", "root"},
+		{"newton root and coef", validQuery + "&formula=newton&root=1,0&root=-1,0&coef=1,0&coef=0,0&coef=-1,0", "coef"},
+		{"newton coef of degree 1", validQuery + "&formula=newton&coef=0,0&coef=1,0&coef=-1,0", "coef"},
+		{"newton coef invalid", validQuery + "&formula=newton&coef=1&coef=0,0&coef=-1,0", "coef"},
+		{"phoenix without p", validQuery + "&formula=phoenix", "p"},
+		{"phoenix p invalid", validQuery + "&formula=phoenix&p=0.5", "p"},
+		{"phoenix p imaginary invalid", validQuery + "&formula=phoenix&p=0.5,NaN", "p"},
+		{"phoenix has no distance", validQuery + "&formula=phoenix&p=0.5,0&channel=distance", "channel"},
+		{"exp has no distance", validQuery + "&formula=exp&channel=distance", "channel"},
+		{"sin has no big precision", validQuery + "&formula=sin&precision=128", "precision"},
+		{"rational without lambda", validQuery + "&formula=rational", "lambda"},
+		{"rational lambda invalid", validQuery + "&formula=rational&lambda=x,0", "lambda"},
+		{"rational needs an integer power", validQuery + "&formula=rational&lambda=0.01,0&power=2.5", "power"},
+		{"rational pole_power not an integer", validQuery + "&formula=rational&lambda=0.01,0&pole_power=1.5", "pole_power"},
+		{"rational pole_power too low", validQuery + "&formula=rational&lambda=0.01,0&pole_power=0", "pole_power"},
+		{"rational pole_power too high", validQuery + "&formula=rational&lambda=0.01,0&pole_power=17", "pole_power"},
+		{"rational has no big precision", validQuery + "&formula=rational&lambda=0.01,0&precision=128", "precision"},
+		{"escape_radius not a number", validQuery + "&escape_radius=big", "escape_radius"},
+		{"escape_radius is NaN", validQuery + "&escape_radius=NaN", "escape_radius"},
+		{"escape_radius zero", validQuery + "&escape_radius=0", "escape_radius"},
+		{"escape_radius negative", validQuery + "&escape_radius=-2", "escape_radius"},
+		{"escape_radius too large", validQuery + "&escape_radius=1e200", "escape_radius"},
+		{"interior_value not a number", validQuery + "&interior_value=none", "interior_value"},
+		{"interior_value beyond float32", validQuery + "&interior_value=1e50", "interior_value"},
+		{"distance at high precision needs power 2", validQuery + "&channel=distance&precision=128&power=3", "channel"},
+		{"power not a number", validQuery + "&power=abc", "power"},
+		{"power too low", validQuery + "&power=1.5", "power"},
+		{"power too high", validQuery + "&power=17", "power"},
+		{"precision not a number", validQuery + "&precision=lots", "precision"},
+		{"precision too low", validQuery + "&precision=32", "precision"},
+		{"precision too high", validQuery + "&precision=100000", "precision"},
+		{"precision with real power", validQuery + "&precision=128&power=2.5", "precision"},
+		{"min_x equals max_x beyond float64", "min_x=0.1000000000000000000001&max_x=0.1000000000000000000001&min_y=0&max_y=1&comp_const=0,0", "min_x"},
+		{"explicit julia needs comp_const", "min_x=-2&max_x=2&min_y=-1.5&max_y=1.5&fractal=julia", "comp_const"},
+		{"mandelbrot still validates comp_const", "min_x=-2&max_x=2&min_y=-1.5&max_y=1.5&fractal=mandelbrot&comp_const=x", "comp_const"},
 	}
 
 	for _, tt := range tests {
@@ -82,7 +643,7 @@ func TestJuliaAPI_ValidationErrors(t *testing.T) {
 			req := httptest.NewRequest("GET", "/satori/julia/api?"+tt.query, nil)
 			w := httptest.NewRecorder()
 
-			JuliaAPI(w, req)
+			srv.JuliaAPI(w, req)
 
 			resp := w.Result()
 			if resp.StatusCode != http.StatusBadRequest {
@@ -102,3 +663,576 @@ func TestJuliaAPI_ValidationErrors(t *testing.T) {
 		})
 	}
 }
+
+func tileRequest(z, x, y, query string) *http.Request {
+	req := httptest.NewRequest("GET", "/satori/julia/tiles/"+z+"/"+x+"/"+y+"?"+query, nil)
+	req.SetPathValue("z", z)
+	req.SetPathValue("x", x)
+	req.SetPathValue("y", y)
+	return req
+}
+
+func TestJuliaTiles_PNG(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	srv.JuliaTiles(w, tileRequest("2", "1", "3", "comp_const=-0.7,0.27015"))
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q, want %q", ct, "image/png")
+	}
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != tileSize || b.Dy() != tileSize {
+		t.Errorf("image size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tileSize, tileSize)
+	}
+}
+
+func TestJuliaTiles_Raw(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	srv.JuliaTiles(w, tileRequest("0", "0", "0", "comp_const=-0.7,0.27015&format=raw"))
+
+	resp := w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/octet-stream")
+	}
+	if w.Body.Len() != tileSize*tileSize*4 {
+		t.Errorf("body size = %d, want %d", w.Body.Len(), tileSize*tileSize*4)
+	}
+}
+
+func TestJuliaTiles_Bounds(t *testing.T) {
+	p, perr := DefaultLimits.parseTileParams("1", "1", "0", url.Values{"comp_const": {"0,0"}})
+	if perr != nil {
+		t.Fatalf("unexpected error: %s", perr.msg)
+	}
+	if p.MinX != 0 || p.MaxX != 2 || p.MinY != -2 || p.MaxY != 0 {
+		t.Errorf("bounds = [%v, %v] x [%v, %v], want [0, 2] x [-2, 0]", p.MinX, p.MaxX, p.MinY, p.MaxY)
+	}
+}
+
+func TestJuliaTiles_DeepBounds(t *testing.T) {
+	// At zoom 60 the tile at x = 3·2^58 + 1 starts at 1 + 2^-58, which
+	// float64 rounds to 1; the exact bounds must keep it.
+	p, perr := DefaultLimits.parseTileParams("60", "864691128455135233", "576460752303423488", url.Values{"comp_const": {"0,0"}})
+	if perr != nil {
+		t.Fatalf("unexpected error: %s", perr.msg)
+	}
+	if p.Prec == 0 || p.Exact == nil {
+		t.Fatalf("precision = %d, want math/big for a zoom beyond 2^53", p.Prec)
+	}
+	want := func(mant, exp int) *big.Float {
+		f := new(big.Float).SetMantExp(big.NewFloat(1), exp).SetPrec(128)
+		return f.Add(f, big.NewFloat(float64(mant)))
+	}
+	if p.Exact.MinX.Cmp(want(1, -58)) != 0 || p.Exact.MaxX.Cmp(want(1, -57)) != 0 {
+		t.Errorf("x bounds = [%s, %s], want [1 + 2^-58, 1 + 2^-57]", p.Exact.MinX.Text('g', 20), p.Exact.MaxX.Text('g', 20))
+	}
+	if p.Exact.MinY.Sign() != 0 || p.Exact.MaxY.Cmp(want(0, -58)) != 0 {
+		t.Errorf("y bounds = [%s, %s], want [0, 2^-58]", p.Exact.MinY.Text('g', 20), p.Exact.MaxY.Text('g', 20))
+	}
+}
+
+func TestJuliaTiles_Deep(t *testing.T) {
+	// x and y beyond int64 address a tile at -0.75 + 0.625i at zoom 100.
+	x := new(big.Int).Lsh(big.NewInt(5), 96)
+	x.Add(x, big.NewInt(12345))
+	y := new(big.Int).Lsh(big.NewInt(21), 95)
+	w := httptest.NewRecorder()
+	srv.JuliaTiles(w, tileRequest("100", x.String(), y.String(), "fractal=mandelbrot&max_iter=64&format=raw"))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if w.Body.Len() != tileSize*tileSize*4 {
+		t.Errorf("body size = %d, want %d", w.Body.Len(), tileSize*tileSize*4)
+	}
+}
+
+func TestJuliaTiles_ValidationErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		z, x, y         string
+		query           string
+		wantErrContains string
+	}{
+		{"z not a number", "a", "0", "0", "comp_const=0,0", "z"},
+		{"z negative", "-1", "0", "0", "comp_const=0,0", "z"},
+		{"z too deep", "1001", "0", "0", "comp_const=0,0", "z"},
+		{"x not an integer", "1", "1.5", "0", "comp_const=0,0", "x"},
+		{"x outside deep zoom level", "70", "1180591620717411303424", "0", "comp_const=0,0", "x"},
+		{"x outside zoom level", "1", "2", "0", "comp_const=0,0", "x"},
+		{"y negative", "1", "0", "-1", "comp_const=0,0", "y"},
+		{"missing comp_const", "0", "0", "0", "", "comp_const"},
+		{"max_iter too high", "0", "0", "0", "comp_const=0,0&max_iter=99999", "max_iter"},
+		{"unknown format", "0", "0", "0", "comp_const=0,0&format=jpeg", "format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			srv.JuliaTiles(w, tileRequest(tt.z, tt.x, tt.y, tt.query))
+
+			resp := w.Result()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+			}
+			var body map[string]string
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response body: %v", err)
+			}
+			if !strings.Contains(body["error"], tt.wantErrContains) {
+				t.Errorf("error = %q, want containing %q", body["error"], tt.wantErrContains)
+			}
+		})
+	}
+}
+
+func TestParseParams_Precision(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantPrec uint
+	}{
+		{"auto stays float64 for normal views", validQuery, 0},
+		{"explicit float64", validQuery + "&precision=float64", 0},
+		{"explicit bits", validQuery + "&precision=256", 256},
+		{"auto switches to math/big for deep zoom", "min_x=-0.7436438870371587&max_x=-0.7436438870371586&min_y=0.1318259042053&max_y=0.13182590420531&comp_const=-0.7,0.27015", 128},
+		{"auto stays float64 for real powers", "min_x=-0.7436438870371587&max_x=-0.7436438870371586&min_y=0.1318259042053&max_y=0.13182590420531&comp_const=-0.7,0.27015&power=2.5", 0},
+		{"digits beyond float64 are kept", "min_x=0.1&max_x=0.1000000000000000000001&min_y=0&max_y=0.0000000000000000000001&comp_const=0,0", 192},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			p, perr := DefaultLimits.parseParams(q)
+			if perr != nil {
+				t.Fatalf("unexpected error: %s", perr.msg)
+			}
+			if p.Prec != tt.wantPrec {
+				t.Errorf("Prec = %d, want %d", p.Prec, tt.wantPrec)
+			}
+			if (p.Prec > 0) != (p.Exact != nil) {
+				t.Errorf("Exact = %v with Prec %d, want bounds exactly when Prec > 0", p.Exact, p.Prec)
+			}
+		})
+	}
+}
+
+func TestJuliaAPI_DeepZoom(t *testing.T) {
+	req := httptest.NewRequest("GET", "/satori/julia/api?fractal=mandelbrot&min_x=-0.75&max_x=-0.7499999999999999999999&min_y=0.1&max_y=0.1000000000000000000001&width=4&height=4&max_iter=64", nil)
+	w := httptest.NewRecorder()
+
+	srv.JuliaAPI(w, req)
+
+	if resp := w.Result(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusOK, w.Body.String())
+	}
+	if w.Body.Len() != 4*4*4 {
+		t.Errorf("body size = %d, want %d", w.Body.Len(), 4*4*4)
+	}
+}
+
+// jobRequest returns a request for path with the id path value set.
+func jobRequest(method, id, suffix string) *http.Request {
+	req := httptest.NewRequest(method, "/satori/julia/jobs/"+id+suffix, nil)
+	req.SetPathValue("id", id)
+	return req
+}
+
+func TestJobs_Lifecycle(t *testing.T) {
+	body := strings.NewReader(validQuery + "&width=16&height=8")
+	req := httptest.NewRequest("POST", "/satori/julia/jobs", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	srv.CreateJob(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, http.StatusAccepted, w.Body.String())
+	}
+	var info jobs.Info
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("failed to decode job: %v", err)
+	}
+	if loc := resp.Header.Get("Location"); loc != "/satori/julia/jobs/"+info.ID {
+		t.Errorf("Location = %q, want the job URL", loc)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for info.Status != jobs.Done {
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", info)
+		}
+		w = httptest.NewRecorder()
+		srv.JobStatus(w, jobRequest("GET", info.ID, ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status request: status = %d, want %d", w.Code, http.StatusOK)
+		}
+		json.NewDecoder(w.Body).Decode(&info)
+	}
+
+	w = httptest.NewRecorder()
+	req = jobRequest("GET", info.ID, "/result")
+	req.URL.RawQuery = "format=png"
+	srv.JobResult(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("result: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Errorf("image size = %dx%d, want 16x8", b.Dx(), b.Dy())
+	}
+
+	w = httptest.NewRecorder()
+	srv.CancelJob(w, jobRequest("DELETE", info.ID, ""))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("delete: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	w = httptest.NewRecorder()
+	srv.JobStatus(w, jobRequest("GET", info.ID, ""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status after delete = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestJobs_ResultNotReady(t *testing.T) {
+	started := make(chan struct{})
+	m := jobs.New(1, time.Minute, func(ctx context.Context, _ julia.Params, _ func()) ([]float32, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	t.Cleanup(m.Close)
+	s := newServer(DefaultLimits, testWorkers, m)
+
+	w := httptest.NewRecorder()
+	s.CreateJob(w, httptest.NewRequest("POST", "/satori/julia/jobs?"+validQuery, nil))
+	var info jobs.Info
+	json.NewDecoder(w.Body).Decode(&info)
+	<-started
+
+	w = httptest.NewRecorder()
+	s.JobResult(w, jobRequest("GET", info.ID, "/result"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("result: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	w = httptest.NewRecorder()
+	s.CreateJob(w, httptest.NewRequest("POST", "/satori/julia/jobs?"+validQuery, nil))
+	if w.Code != http.StatusServiceUnavailable || w.Result().Header.Get("Retry-After") == "" {
+		t.Errorf("second job: status = %d, want %d with Retry-After", w.Code, http.StatusServiceUnavailable)
+	}
+
+	w = httptest.NewRecorder()
+	s.CancelJob(w, jobRequest("DELETE", info.ID, ""))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("delete: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestJobs_Errors(t *testing.T) {
+	w := httptest.NewRecorder()
+	srv.CreateJob(w, httptest.NewRequest("POST", "/satori/julia/jobs?min_x=-2", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid params: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	for _, h := range []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		suffix  string
+	}{
+		{"status", srv.JobStatus, "GET", ""},
+		{"result", srv.JobResult, "GET", "/result"},
+		{"delete", srv.CancelJob, "DELETE", ""},
+	} {
+		w := httptest.NewRecorder()
+		h.handler(w, jobRequest(h.method, "nope", h.suffix))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s of unknown job: status = %d, want %d", h.name, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+// waitForJob polls the job with the given ID until it is done.
+func waitForJob(t *testing.T, id string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		srv.JobStatus(w, jobRequest("GET", id, ""))
+		var info jobs.Info
+		json.NewDecoder(w.Body).Decode(&info)
+		if info.Status == jobs.Done {
+			return
+		}
+		if info.Status == jobs.Failed || time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", info)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoster(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantType string
+	}{
+		{"png", "", "image/png"},
+		{"raw", "&format=raw", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Wider than the /api limit, and not a multiple of the strip height.
+			req := httptest.NewRequest("POST", "/satori/julia/jobs/poster?"+validQuery+"&width=5000&height=70&max_iter=20"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			srv.CreatePoster(w, req)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+			}
+			var info jobs.Info
+			json.NewDecoder(w.Body).Decode(&info)
+			if loc := w.Result().Header.Get("Location"); loc != "/satori/julia/jobs/"+info.ID {
+				t.Errorf("Location = %q, want the job URL", loc)
+			}
+			waitForJob(t, info.ID)
+			defer srv.CancelJob(httptest.NewRecorder(), jobRequest("DELETE", info.ID, ""))
+
+			w = httptest.NewRecorder()
+			srv.JobResult(w, jobRequest("GET", info.ID, "/result"))
+			if w.Code != http.StatusOK {
+				t.Fatalf("result: status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if ct := w.Result().Header.Get("Content-Type"); ct != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantType)
+			}
+			if tt.wantType == "image/png" {
+				img, err := png.Decode(w.Body)
+				if err != nil {
+					t.Fatalf("png.Decode: %v", err)
+				}
+				if b := img.Bounds(); b.Dx() != 5000 || b.Dy() != 70 {
+					t.Errorf("image size = %dx%d, want 5000x70", b.Dx(), b.Dy())
+				}
+			} else if w.Body.Len() != 5000*70*4 {
+				t.Errorf("body size = %d, want %d", w.Body.Len(), 5000*70*4)
+			}
+		})
+	}
+}
+
+func TestPoster_MatchesAPI(t *testing.T) {
+	query := validQuery + "&width=40&height=30&max_iter=50"
+	w := httptest.NewRecorder()
+	srv.JuliaAPI(w, httptest.NewRequest("GET", "/satori/julia/api?"+query+"&format=png", nil))
+	want, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	srv.CreatePoster(w, httptest.NewRequest("POST", "/satori/julia/jobs/poster?"+query, nil))
+	var info jobs.Info
+	json.NewDecoder(w.Body).Decode(&info)
+	waitForJob(t, info.ID)
+	defer srv.CancelJob(httptest.NewRecorder(), jobRequest("DELETE", info.ID, ""))
+
+	w = httptest.NewRecorder()
+	srv.JobResult(w, jobRequest("GET", info.ID, "/result"))
+	got, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			r1, g1, b1, _ := got.At(x, y).RGBA()
+			r2, g2, b2, _ := want.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				t.Fatalf("pixel (%d, %d) differs from /api output", x, y)
+			}
+		}
+	}
+}
+
+func TestPoster_ValidationErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		wantErrContains string
+	}{
+		{"width above poster limit", validQuery + "&width=40000", "width"},
+		{"envelope format", validQuery + "&format=envelope", "format"},
+		{"missing viewport", "comp_const=0,0", "min_x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.CreatePoster(w, httptest.NewRequest("POST", "/satori/julia/jobs/poster?"+tt.query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantErrContains) {
+				t.Errorf("body = %q, want containing %q", w.Body.String(), tt.wantErrContains)
+			}
+		})
+	}
+}
+
+func TestJuliaAnimation(t *testing.T) {
+	paths := []string{
+		"path=circle&center=0,0&radius=0.7885",
+		"path=line&from=-0.8,0.156&to=-0.7,0.27015",
+		"path=keyframes&keyframe=-0.8,0.156&keyframe=-0.7,0.27015&keyframe=0.285,0.01",
+	}
+	for _, path := range paths {
+		req := httptest.NewRequest("GET", "/satori/julia/animation?min_x=-2&max_x=2&min_y=-1.5&max_y=1.5&width=16&height=12&max_iter=50&frames=5&delay=8&"+path, nil)
+		w := httptest.NewRecorder()
+
+		srv.JuliaAnimation(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", path, w.Code, http.StatusOK, w.Body.String())
+		}
+		if ct := w.Result().Header.Get("Content-Type"); ct != "image/gif" {
+			t.Errorf("%s: Content-Type = %q, want image/gif", path, ct)
+		}
+		anim, err := gif.DecodeAll(w.Body)
+		if err != nil {
+			t.Fatalf("%s: gif.DecodeAll: %v", path, err)
+		}
+		if len(anim.Image) != 5 || anim.Delay[0] != 8 {
+			t.Errorf("%s: %d frames with delay %d, want 5 with delay 8", path, len(anim.Image), anim.Delay[0])
+		}
+	}
+}
+
+func TestJuliaAnimation_ValidationErrors(t *testing.T) {
+	const view = "min_x=-2&max_x=2&min_y=-1.5&max_y=1.5&"
+	tests := []struct {
+		name            string
+		query           string
+		wantErrContains string
+	}{
+		{"missing path", view, "path"},
+		{"unknown path", view + "path=spiral", "path"},
+		{"circle missing center", view + "path=circle&radius=1", "center"},
+		{"circle bad radius", view + "path=circle&center=0,0&radius=-1", "radius"},
+		{"line missing to", view + "path=line&from=0,0", "to"},
+		{"line bad from", view + "path=line&from=0&to=1,1", "from"},
+		{"one keyframe", view + "path=keyframes&keyframe=0,0", "keyframe"},
+		{"bad keyframe", view + "path=keyframes&keyframe=0,0&keyframe=x,1", "keyframe"},
+		{"too few frames", view + "path=line&from=0,0&to=1,1&frames=1", "frames"},
+		{"delay not a number", view + "path=line&from=0,0&to=1,1&delay=fast", "delay"},
+		{"too many pixels", view + "path=line&from=0,0&to=1,1&width=2048&height=2048&frames=100", "pixels"},
+		{"mandelbrot", view + "path=line&from=0,0&to=1,1&fractal=mandelbrot", "fractal"},
+		{"newton", view + "path=line&from=0,0&to=1,1&formula=newton", "formula"},
+		{"missing viewport", "path=line&from=0,0&to=1,1", "min_x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.JuliaAnimation(w, httptest.NewRequest("GET", "/satori/julia/animation?"+tt.query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantErrContains) {
+				t.Errorf("body = %q, want containing %q", w.Body.String(), tt.wantErrContains)
+			}
+		})
+	}
+}
+
+func TestParamErrors_CountedByKind(t *testing.T) {
+	tests := []struct {
+		query string
+		kind  string
+	}{
+		{"max_x=2&min_y=-2&max_y=2&comp_const=0,0", "missing"},
+		{"min_x=a&max_x=2&min_y=-2&max_y=2&comp_const=0,0", "invalid"},
+		{"min_x=-2&max_x=2&min_y=-2&max_y=2&comp_const=0,0&fractal=x", "invalid"},
+		{"min_x=-2&max_x=2&min_y=-2&max_y=2&comp_const=0,0&width=0", "out_of_range"},
+		{"min_x=2&max_x=-2&min_y=-2&max_y=2&comp_const=0,0", "out_of_range"},
+		{"min_x=-2&max_x=2&min_y=-2&max_y=2&formula=newton&root=1,0&root=-1,0&coef=1,0&coef=0,0&coef=-1,0", "conflict"},
+		{"min_x=-2&max_x=2&min_y=-2&max_y=2&formula=newton&fractal=mandelbrot", "conflict"},
+		{"min_x=-2&max_x=2&min_y=-2&max_y=2&comp_const=0,0&formula=exp&precision=128", "conflict"},
+		{"min_x=-2&max_x=2&min_y=-2&max_y=2&comp_const=0,0&channel=distance&formula=tricorn", "conflict"},
+	}
+	for _, tt := range tests {
+		before := paramErrors.With(tt.kind).Value()
+		w := httptest.NewRecorder()
+		srv.JuliaAPI(w, httptest.NewRequest("GET", "/satori/julia/api?"+tt.query, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want %d", tt.query, w.Code, http.StatusBadRequest)
+		}
+		if got := paramErrors.With(tt.kind).Value() - before; got != 1 {
+			t.Errorf("%s: %s errors counted %d times, want 1", tt.query, tt.kind, got)
+		}
+	}
+}
+
+func TestJuliaAPI_AccessLog(t *testing.T) {
+	var out bytes.Buffer
+	h := accesslog.Middleware(slog.New(slog.NewJSONHandler(&out, nil)), http.HandlerFunc(srv.JuliaAPI))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&width=16&height=8&max_iter=77", nil))
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("log output %q: %v", out.String(), err)
+	}
+	params, _ := record["params"].(map[string]any)
+	if params["width"] != float64(16) || params["max_iter"] != float64(77) {
+		t.Errorf("params = %v, want width 16 and max_iter 77", params)
+	}
+	if _, ok := record["render_duration"]; !ok {
+		t.Error("render_duration missing")
+	}
+
+	out.Reset()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/satori/julia/api?min_x=1", nil))
+	record = nil
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("log output %q: %v", out.String(), err)
+	}
+	if record["status"] != float64(400) || !strings.Contains(record["error"].(string), "max_x") {
+		t.Errorf("record = %v, want status 400 with the validation error", record)
+	}
+}
+
+func TestNew_Limits(t *testing.T) {
+	l := DefaultLimits
+	l.DefaultWidth, l.DefaultHeight, l.MaxMaxIter = 8, 4, 300
+	s := newServer(l, testWorkers, nil)
+	w := httptest.NewRecorder()
+	s.JuliaAPI(w, httptest.NewRequest("GET", "/satori/julia/api?"+validQuery, nil))
+	if w.Body.Len() != 8*4*4 {
+		t.Errorf("body size = %d, want the 8x4 default", w.Body.Len())
+	}
+	w = httptest.NewRecorder()
+	s.JuliaAPI(w, httptest.NewRequest("GET", "/satori/julia/api?"+validQuery+"&max_iter=301", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "300") {
+		t.Errorf("max_iter above the limit: status %d, body %q", w.Code, w.Body.String())
+	}
+
+	l.DefaultMaxIter = 500
+	if _, err := New(l, srv.renderer, srv.tiles, srv.jobs); err == nil {
+		t.Error("New accepted a default max_iter above the limit")
+	}
+}
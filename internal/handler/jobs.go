@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/accesslog"
+	"github.com/kqnade/julia-web-server/internal/jobs"
+)
+
+const (
+	// DefaultMaxJobs is the default number of jobs a job manager holds.
+	DefaultMaxJobs = 16
+	// DefaultJobTTL is how long finished jobs are kept by default.
+	DefaultJobTTL = 10 * time.Minute
+)
+
+// CreateJob handles POST requests that queue a render in the background.
+// It takes the same parameters as JuliaAPI, in the query string or a form
+// body, and responds 202 Accepted with the job and its URL in Location.
+func (s *Server) CreateJob(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		accesslog.SetError(r.Context(), err.Error())
+		writeError(w, http.StatusBadRequest, "invalid form body: "+err.Error())
+		return
+	}
+	params, perr := s.limits.parseParams(r.Form)
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+	accesslog.SetParams(r.Context(), params)
+
+	info, err := s.jobs.Submit(params)
+	if errors.Is(err, jobs.ErrTooManyJobs) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "server busy: too many jobs")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", r.URL.Path+"/"+info.ID)
+	writeJob(w, http.StatusAccepted, info)
+}
+
+// CreatePoster handles POST requests that queue a poster: a render larger
+// than JuliaAPI allows, computed in strips and streamed to a temporary
+// file as PNG (the default) or raw float32 data. It responds like
+// CreateJob, and the poster is fetched from the job's result.
+func (s *Server) CreatePoster(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		accesslog.SetError(r.Context(), err.Error())
+		writeError(w, http.StatusBadRequest, "invalid form body: "+err.Error())
+		return
+	}
+	params, perr := s.limits.parsePosterParams(r.Form)
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+	accesslog.SetParams(r.Context(), params)
+	format, perr := parseFormat(r.Form, formatPNG)
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+
+	var contentType string
+	switch format {
+	case formatPNG:
+		contentType = "image/png"
+		params.Interior = nil
+	case formatRaw:
+		contentType = "application/octet-stream"
+	default:
+		writeParamError(w, r, invalidParam("invalid format: posters must be %s or %s", formatPNG, formatRaw))
+		return
+	}
+
+	info, err := s.jobs.SubmitFile(params, contentType, s.posterWriter(params, format))
+	if errors.Is(err, jobs.ErrTooManyJobs) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "server busy: too many jobs")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", path.Dir(r.URL.Path)+"/"+info.ID)
+	writeJob(w, http.StatusAccepted, info)
+}
+
+// JobStatus handles GET requests for a job's status and progress.
+func (s *Server) JobStatus(w http.ResponseWriter, r *http.Request) {
+	info, err := s.jobs.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJob(w, http.StatusOK, info)
+}
+
+// JobResult handles GET requests for a finished job's buffer, in the format
+// given by the format parameter (default raw). Posters are served in the
+// format they were created with.
+func (s *Server) JobResult(w http.ResponseWriter, r *http.Request) {
+	format, perr := parseFormat(r.URL.Query(), formatRaw)
+	if perr != nil {
+		writeParamError(w, r, perr)
+		return
+	}
+	out, info, err := s.jobs.Result(r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("job %s is %s", info.ID, info.Status)
+		if info.Error != "" {
+			msg += ": " + info.Error
+		}
+		writeError(w, http.StatusConflict, msg)
+		return
+	}
+	if out.File != "" {
+		serveFile(w, r, out.File, out.ContentType)
+		return
+	}
+	writeBuffer(w, out.Params, format, out.Buf)
+}
+
+// serveFile serves a job's output file, which may be removed at any time
+// after it is opened.
+func serveFile(w http.ResponseWriter, r *http.Request, name, contentType string) {
+	f, err := os.Open(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+// CancelJob handles DELETE requests, stopping a job and discarding it.
+func (s *Server) CancelJob(w http.ResponseWriter, r *http.Request) {
+	if err := s.jobs.Cancel(r.PathValue("id")); err != nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJob writes a job snapshot as JSON with the given status code.
+func writeJob(w http.ResponseWriter, status int, info jobs.Info) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(info)
+}
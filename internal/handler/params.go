@@ -1,136 +1,825 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"net/url"
 	"strconv"
 	"strings"
 
+	"github.com/kqnade/julia-web-server/internal/animation"
 	"github.com/kqnade/julia-web-server/internal/julia"
+	"github.com/kqnade/julia-web-server/internal/renderer"
 )
 
 const (
-	defaultWidth   = 256
-	defaultHeight  = 256
-	defaultMaxIter = julia.DefaultMaxIter
-
 	minDimension = 1
-	maxDimension = 4096
 	minMaxIter   = 1
-	maxMaxIter   = 10000
+	minPower     = 2.0
+	maxPower     = 16.0
+
+	// maxEscapeRadius keeps the squared radius far from float64 overflow.
+	maxEscapeRadius = 1e100
+)
+
+// Precision modes accepted by the precision query parameter. Besides these,
+// precision may be a number of mantissa bits for math/big.
+const (
+	precisionAuto    = "auto"
+	precisionFloat64 = "float64"
+
+	minPrecision = 64
+	maxPrecision = 4096
+
+	// float64Mantissa is the number of mantissa bits in a float64, and
+	// autoPrecisionSlack the bits left over for iteration error before
+	// precision=auto switches to math/big.
+	float64Mantissa    = 53
+	autoPrecisionSlack = 12
+)
+
+// Slippy-map tiles cover the square [-2, 2] x [-2, 2] at zoom 0 and are
+// split into quadrants at each further zoom level.
+const (
+	tileSize     = 256
+	tileRootMinX = -2.0
+	tileRootMinY = -2.0
+	tileRootSpan = 4.0
+
+	// maxTileZoom keeps the pixel spacing of a tile, 2^-(z+6), within the
+	// float64 range in which precision=auto measures it.
+	maxTileZoom = 1000
+)
+
+// Newton limits. Without root or coef parameters, Newton renders solve
+// z^defaultNewtonDegree - 1.
+const (
+	minRoots            = 2
+	maxRoots            = 16
+	defaultNewtonDegree = 3
 )
 
-// parseParams parses and validates query parameters, returning julia.Params or an error message.
-func parseParams(q url.Values) (julia.Params, string) {
+// Rational map limits. Without a pole_power parameter, the pole has the
+// degree given by power.
+const (
+	minPolePower = 1
+	maxPolePower = 16
+)
+
+// Output formats accepted by the format query parameter.
+const (
+	formatRaw      = "raw"
+	formatPNG      = "png"
+	formatEnvelope = "envelope"
+)
+
+// Animation limits.
+const (
+	defaultFrames = 60
+	minFrames     = 2
+	maxFrames     = 360
+
+	// Frame delays are in hundredths of a second, as in GIF.
+	defaultFrameDelay = 5
+	minFrameDelay     = 1
+	maxFrameDelay     = 1000
+
+	maxKeyframes = 64
+)
+
+// Limits are the request defaults and limits that can be changed at
+// startup.
+type Limits struct {
+	DefaultWidth   int
+	DefaultHeight  int
+	DefaultMaxIter int
+
+	MaxDimension int
+	// MaxPosterDimension is the size limit for posters, which are rendered
+	// in strips and never held in memory whole.
+	MaxPosterDimension int
+	MaxMaxIter         int
+	// MaxAnimationPixels bounds width*height*frames of an animation.
+	MaxAnimationPixels int
+}
+
+// DefaultLimits are the limits of the default server configuration.
+var DefaultLimits = Limits{
+	DefaultWidth:       256,
+	DefaultHeight:      256,
+	DefaultMaxIter:     julia.DefaultMaxIter,
+	MaxDimension:       4096,
+	MaxPosterDimension: 32768,
+	MaxMaxIter:         10000,
+	MaxAnimationPixels: 1 << 25, // 128 frames of 512x512
+}
+
+// Validate reports whether l is consistent: every limit is at least its
+// minimum and every default within its limit.
+func (l Limits) Validate() error {
+	switch {
+	case l.MaxDimension < minDimension:
+		return fmt.Errorf("max dimension must be at least %d, got %d", minDimension, l.MaxDimension)
+	case l.MaxPosterDimension < l.MaxDimension:
+		return fmt.Errorf("max poster dimension %d is below max dimension %d", l.MaxPosterDimension, l.MaxDimension)
+	case l.MaxMaxIter < minMaxIter:
+		return fmt.Errorf("max iteration limit must be at least %d, got %d", minMaxIter, l.MaxMaxIter)
+	case l.DefaultWidth < minDimension || l.DefaultWidth > l.MaxDimension:
+		return fmt.Errorf("default width must be between %d and %d, got %d", minDimension, l.MaxDimension, l.DefaultWidth)
+	case l.DefaultHeight < minDimension || l.DefaultHeight > l.MaxDimension:
+		return fmt.Errorf("default height must be between %d and %d, got %d", minDimension, l.MaxDimension, l.DefaultHeight)
+	case l.DefaultMaxIter < minMaxIter || l.DefaultMaxIter > l.MaxMaxIter:
+		return fmt.Errorf("default max_iter must be between %d and %d, got %d", minMaxIter, l.MaxMaxIter, l.DefaultMaxIter)
+	case l.MaxAnimationPixels < minFrames:
+		return fmt.Errorf("max animation pixels must be at least %d, got %d", minFrames, l.MaxAnimationPixels)
+	}
+	return nil
+}
+
+// Paths accepted by the path query parameter.
+const (
+	pathCircle    = "circle"
+	pathLine      = "line"
+	pathKeyframes = "keyframes"
+)
+
+// Kinds of parameter errors, the kind label of julia_param_errors_total.
+const (
+	kindMissing    = "missing"      // a required parameter is absent
+	kindInvalid    = "invalid"      // a value is unparseable or not an allowed name
+	kindOutOfRange = "out_of_range" // a value is outside its bounds
+	kindConflict   = "conflict"     // values are valid alone but not together
+)
+
+// paramError is a rejected request parameter: the message returned to the
+// client and the kind of rule it broke.
+type paramError struct {
+	kind string
+	msg  string
+}
+
+func newParamError(kind, format string, args ...any) *paramError {
+	return &paramError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+func missingParam(format string, args ...any) *paramError {
+	return newParamError(kindMissing, format, args...)
+}
+
+func invalidParam(format string, args ...any) *paramError {
+	return newParamError(kindInvalid, format, args...)
+}
+
+func paramOutOfRange(format string, args ...any) *paramError {
+	return newParamError(kindOutOfRange, format, args...)
+}
+
+func paramConflict(format string, args ...any) *paramError {
+	return newParamError(kindConflict, format, args...)
+}
+
+// parseParams parses and validates query parameters, returning julia.Params or an error.
+func (l Limits) parseParams(q url.Values) (julia.Params, *paramError) {
+	return l.parseSizedParams(q, l.MaxDimension)
+}
+
+// parsePosterParams is parseParams with the poster size limit.
+func (l Limits) parsePosterParams(q url.Values) (julia.Params, *paramError) {
+	return l.parseSizedParams(q, l.MaxPosterDimension)
+}
+
+// parseSizedParams is parseParams with width and height limited to maxDim.
+func (l Limits) parseSizedParams(q url.Values, maxDim int) (julia.Params, *paramError) {
 	// Required parameters
 	minXStr := q.Get("min_x")
 	if minXStr == "" {
-		return julia.Params{}, "missing required parameter: min_x"
+		return julia.Params{}, missingParam("missing required parameter: min_x")
 	}
 	maxXStr := q.Get("max_x")
 	if maxXStr == "" {
-		return julia.Params{}, "missing required parameter: max_x"
+		return julia.Params{}, missingParam("missing required parameter: max_x")
 	}
 	minYStr := q.Get("min_y")
 	if minYStr == "" {
-		return julia.Params{}, "missing required parameter: min_y"
+		return julia.Params{}, missingParam("missing required parameter: min_y")
 	}
 	maxYStr := q.Get("max_y")
 	if maxYStr == "" {
-		return julia.Params{}, "missing required parameter: max_y"
+		return julia.Params{}, missingParam("missing required parameter: max_y")
 	}
-	compConstStr := q.Get("comp_const")
-	if compConstStr == "" {
-		return julia.Params{}, "missing required parameter: comp_const"
-	}
-
 	// Parse required float parameters
 	minX, err := strconv.ParseFloat(minXStr, 64)
 	if err != nil || math.IsNaN(minX) || math.IsInf(minX, 0) {
-		return julia.Params{}, fmt.Sprintf("invalid min_x: %q is not a valid number", minXStr)
+		return julia.Params{}, invalidParam("invalid min_x: %q is not a valid number", minXStr)
 	}
 	maxX, err := strconv.ParseFloat(maxXStr, 64)
 	if err != nil || math.IsNaN(maxX) || math.IsInf(maxX, 0) {
-		return julia.Params{}, fmt.Sprintf("invalid max_x: %q is not a valid number", maxXStr)
+		return julia.Params{}, invalidParam("invalid max_x: %q is not a valid number", maxXStr)
 	}
 	minY, err := strconv.ParseFloat(minYStr, 64)
 	if err != nil || math.IsNaN(minY) || math.IsInf(minY, 0) {
-		return julia.Params{}, fmt.Sprintf("invalid min_y: %q is not a valid number", minYStr)
+		return julia.Params{}, invalidParam("invalid min_y: %q is not a valid number", minYStr)
 	}
 	maxY, err := strconv.ParseFloat(maxYStr, 64)
 	if err != nil || math.IsNaN(maxY) || math.IsInf(maxY, 0) {
-		return julia.Params{}, fmt.Sprintf("invalid max_y: %q is not a valid number", maxYStr)
+		return julia.Params{}, invalidParam("invalid max_y: %q is not a valid number", maxYStr)
 	}
 
-	// Parse comp_const
-	parts := strings.SplitN(compConstStr, ",", 3)
-	if len(parts) != 2 {
-		return julia.Params{}, fmt.Sprintf("invalid comp_const: %q must be two comma-separated numbers", compConstStr)
-	}
-	cReal, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
-	if err != nil || math.IsNaN(cReal) || math.IsInf(cReal, 0) {
-		return julia.Params{}, fmt.Sprintf("invalid comp_const real part: %q is not a valid number", parts[0])
-	}
-	cImag, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
-	if err != nil || math.IsNaN(cImag) || math.IsInf(cImag, 0) {
-		return julia.Params{}, fmt.Sprintf("invalid comp_const imaginary part: %q is not a valid number", parts[1])
+	// Keep every digit given so deep zooms can use the high-precision path.
+	exact := &julia.Viewport{
+		MinX: parseBigFloat(minXStr),
+		MaxX: parseBigFloat(maxXStr),
+		MinY: parseBigFloat(minYStr),
+		MaxY: parseBigFloat(maxYStr),
 	}
 
 	// Validate ranges
-	if minX >= maxX {
-		return julia.Params{}, fmt.Sprintf("min_x (%v) must be less than max_x (%v)", minX, maxX)
+	if exact.MinX.Cmp(exact.MaxX) >= 0 {
+		return julia.Params{}, paramOutOfRange("min_x (%s) must be less than max_x (%s)", minXStr, maxXStr)
 	}
-	if minY >= maxY {
-		return julia.Params{}, fmt.Sprintf("min_y (%v) must be less than max_y (%v)", minY, maxY)
+	if exact.MinY.Cmp(exact.MaxY) >= 0 {
+		return julia.Params{}, paramOutOfRange("min_y (%s) must be less than max_y (%s)", minYStr, maxYStr)
 	}
 
 	// Optional parameters with defaults
-	width := defaultWidth
+	width := l.DefaultWidth
 	if ws := q.Get("width"); ws != "" {
 		w, err := strconv.Atoi(ws)
 		if err != nil {
-			return julia.Params{}, fmt.Sprintf("invalid width: %q is not a valid integer", ws)
+			return julia.Params{}, invalidParam("invalid width: %q is not a valid integer", ws)
 		}
-		if w < minDimension || w > maxDimension {
-			return julia.Params{}, fmt.Sprintf("width must be between %d and %d, got %d", minDimension, maxDimension, w)
+		if w < minDimension || w > maxDim {
+			return julia.Params{}, paramOutOfRange("width must be between %d and %d, got %d", minDimension, maxDim, w)
 		}
 		width = w
 	}
 
-	height := defaultHeight
+	height := l.DefaultHeight
 	if hs := q.Get("height"); hs != "" {
 		h, err := strconv.Atoi(hs)
 		if err != nil {
-			return julia.Params{}, fmt.Sprintf("invalid height: %q is not a valid integer", hs)
+			return julia.Params{}, invalidParam("invalid height: %q is not a valid integer", hs)
 		}
-		if h < minDimension || h > maxDimension {
-			return julia.Params{}, fmt.Sprintf("height must be between %d and %d, got %d", minDimension, maxDimension, h)
+		if h < minDimension || h > maxDim {
+			return julia.Params{}, paramOutOfRange("height must be between %d and %d, got %d", minDimension, maxDim, h)
 		}
 		height = h
 	}
 
-	maxIter := defaultMaxIter
-	if ms := q.Get("max_iter"); ms != "" {
-		m, err := strconv.Atoi(ms)
-		if err != nil {
-			return julia.Params{}, fmt.Sprintf("invalid max_iter: %q is not a valid integer", ms)
+	p := julia.Params{
+		MinX:   minX,
+		MaxX:   maxX,
+		MinY:   minY,
+		MaxY:   maxY,
+		Width:  width,
+		Height: height,
+		Exact:  exact,
+	}
+	if perr := l.parseOptions(q, &p); perr != nil {
+		return julia.Params{}, perr
+	}
+	return p, nil
+}
+
+// parseOptions parses the parameters shared by every render endpoint into p.
+func (l Limits) parseOptions(q url.Values, p *julia.Params) *paramError {
+	fractal := julia.Julia
+	if fs := q.Get("fractal"); fs != "" {
+		f, ok := julia.ParseFractal(fs)
+		if !ok {
+			return invalidParam("invalid fractal: %q must be one of %s, %s", fs, julia.Julia, julia.Mandelbrot)
 		}
-		if m < minMaxIter || m > maxMaxIter {
-			return julia.Params{}, fmt.Sprintf("max_iter must be between %d and %d, got %d", minMaxIter, maxMaxIter, m)
+		fractal = f
+	}
+
+	formula := julia.Polynomial
+	if fs := q.Get("formula"); fs != "" {
+		f, ok := julia.ParseFormula(fs)
+		if !ok {
+			return invalidParam("invalid formula: %q must be one of %s, %s, %s, %s, %s, %s, %s, %s, %s", fs,
+				julia.Polynomial, julia.BurningShip, julia.Tricorn, julia.Newton, julia.Phoenix, julia.Exp, julia.Sin, julia.Cos, julia.Rational)
 		}
-		maxIter = m
+		formula = f
+	}
+	transcendental := formula == julia.Exp || formula == julia.Sin || formula == julia.Cos
+	if formula == julia.Newton && fractal != julia.Julia {
+		return paramConflict("formula %s iterates the pixel and needs fractal %s, got %s", formula, julia.Julia, fractal)
 	}
 
-	return julia.Params{
-		MinX:         minX,
-		MaxX:         maxX,
-		MinY:         minY,
-		MaxY:         maxY,
-		C:            complex(cReal, cImag),
-		Width:        width,
-		Height:       height,
-		MaxIter:      maxIter,
-		EscapeRadius: julia.DefaultEscapeRadius,
-	}, ""
+	channel := julia.Smooth
+	if cs := q.Get("channel"); cs != "" {
+		ch, ok := julia.ParseChannel(cs)
+		if !ok {
+			return invalidParam("invalid channel: %q must be one of %s, %s", cs, julia.Smooth, julia.Distance)
+		}
+		channel = ch
+	}
+	if channel == julia.Distance && formula != julia.Polynomial {
+		return paramConflict("channel %s requires formula %s, got %s", channel, julia.Polynomial, formula)
+	}
+
+	// comp_const is the fixed c of a Julia set; the Mandelbrot set takes c
+	// from the pixel and Newton's method has none, so there it is optional
+	// and unused.
+	var c complex128
+	compConstStr := q.Get("comp_const")
+	if compConstStr == "" {
+		if fractal == julia.Julia && formula != julia.Newton {
+			return missingParam("missing required parameter: comp_const")
+		}
+	} else {
+		var perr *paramError
+		c, perr = parseCompConst(compConstStr)
+		if perr != nil {
+			return perr
+		}
+	}
+
+	maxIter, perr := l.parseMaxIter(q)
+	if perr != nil {
+		return perr
+	}
+
+	power := julia.DefaultPower
+	if ps := q.Get("power"); ps != "" {
+		d, err := strconv.ParseFloat(ps, 64)
+		if err != nil || math.IsNaN(d) {
+			return invalidParam("invalid power: %q is not a valid number", ps)
+		}
+		if d < minPower || d > maxPower {
+			return paramOutOfRange("power must be between %v and %v, got %v", minPower, maxPower, d)
+		}
+		power = d
+	}
+
+	prec, perr := parsePrecision(q, *p, power)
+	if perr != nil {
+		return perr
+	}
+	if (formula == julia.Newton || transcendental || formula == julia.Rational) && prec > 0 {
+		// Newton's method converges in a few steps and gains nothing from
+		// math/big, math/big has no exp, sin or cos, and rational maps have
+		// no math/big iteration; deep zooms of these render in float64.
+		if ps := q.Get("precision"); ps != "" && ps != precisionAuto {
+			return paramConflict("precision %s is not supported by formula %s", ps, formula)
+		}
+		prec = 0
+	}
+
+	var roots []complex128
+	if formula == julia.Newton {
+		roots, perr = parseRoots(q)
+		if perr != nil {
+			return perr
+		}
+	}
+
+	// p weights the previous iterate of the Phoenix formula, which has no
+	// natural default, so it is required there and unused elsewhere.
+	var phoenixP complex128
+	if formula == julia.Phoenix {
+		ps := q.Get("p")
+		if ps == "" {
+			return missingParam("missing required parameter: p (formula %s)", formula)
+		}
+		phoenixP, perr = parseComplex("p", ps)
+		if perr != nil {
+			return perr
+		}
+	}
+
+	// The rational formula takes λ from the pixel on the Mandelbrot plane,
+	// so lambda is only required on the Julia plane.
+	var lambda complex128
+	var polePower int
+	if formula == julia.Rational {
+		if power != math.Trunc(power) {
+			return paramConflict("formula %s requires an integer power, got %v", formula, power)
+		}
+		polePower = int(power)
+		if ms := q.Get("pole_power"); ms != "" {
+			m, err := strconv.Atoi(ms)
+			if err != nil {
+				return invalidParam("invalid pole_power: %q is not a valid integer", ms)
+			}
+			if m < minPolePower || m > maxPolePower {
+				return paramOutOfRange("pole_power must be between %d and %d, got %d", minPolePower, maxPolePower, m)
+			}
+			polePower = m
+		}
+		if fractal == julia.Julia {
+			ls := q.Get("lambda")
+			if ls == "" {
+				return missingParam("missing required parameter: lambda (formula %s)", formula)
+			}
+			lambda, perr = parseComplex("lambda", ls)
+			if perr != nil {
+				return perr
+			}
+		}
+	}
+	if channel == julia.Distance && prec > 0 && power != julia.DefaultPower {
+		return paramConflict("channel %s at precision %d requires power 2, got %v", channel, prec, power)
+	}
+	if channel == julia.Distance && prec > 0 && renderer.BelowPerturbationLimit(*p, prec) {
+		// Past the perturbation limit every pixel iterates in math/big,
+		// which only computes the smooth count.
+		return paramConflict("channel %s requires a pixel spacing of at least %g", channel, renderer.MinPerturbationSpacing)
+	}
+
+	// For d >= 2, |z| > max(|c|, 2^(1/(d-1))) diverges and 2^(1/(d-1)) <= 2,
+	// so the quadratic bailout is valid for every accepted power. The
+	// transcendental formulas bound Re z or |Im z| instead, much further out.
+	escapeRadius := julia.DefaultEscapeRadius
+	switch {
+	case channel == julia.Distance:
+		escapeRadius = julia.DistanceEscapeRadius
+	case transcendental:
+		escapeRadius = julia.TranscendentalEscapeRadius
+	}
+	if es := q.Get("escape_radius"); es != "" {
+		r, err := strconv.ParseFloat(es, 64)
+		if err != nil || math.IsNaN(r) {
+			return invalidParam("invalid escape_radius: %q is not a valid number", es)
+		}
+		if !(r > 0) || r > maxEscapeRadius {
+			return paramOutOfRange("escape_radius must be greater than 0 and at most %v, got %v", maxEscapeRadius, r)
+		}
+		escapeRadius = r
+	}
+
+	interior, perr := parseInterior(q)
+	if perr != nil {
+		return perr
+	}
+
+	p.Fractal = fractal
+	p.Formula = formula
+	p.Channel = channel
+	p.C = c
+	p.MaxIter = maxIter
+	p.Power = power
+	p.EscapeRadius = escapeRadius
+	p.Interior = interior
+	p.Roots = roots
+	p.P = phoenixP
+	p.Lambda = lambda
+	p.PolePower = polePower
+	p.Prec = prec
+	if prec == 0 {
+		p.Exact = nil
+	}
+	return nil
+}
+
+// parseRoots parses the roots of a Newton render, given as repeated root
+// parameters or as the repeated coef parameters of the polynomial, highest
+// degree first, in the real,imag syntax of comp_const.
+func parseRoots(q url.Values) ([]complex128, *paramError) {
+	rs, cs := q["root"], q["coef"]
+	switch {
+	case len(rs) > 0 && len(cs) > 0:
+		return nil, paramConflict("root and coef cannot be combined")
+	case len(rs) > 0:
+		if len(rs) < minRoots || len(rs) > maxRoots {
+			return nil, paramOutOfRange("root must be given between %d and %d times, got %d", minRoots, maxRoots, len(rs))
+		}
+		roots := make([]complex128, len(rs))
+		for i, s := range rs {
+			r, perr := parseComplex("root", s)
+			if perr != nil {
+				return nil, perr
+			}
+			roots[i] = r
+		}
+		return roots, nil
+	case len(cs) > 0:
+		coef := make([]complex128, len(cs))
+		for i, s := range cs {
+			a, perr := parseComplex("coef", s)
+			if perr != nil {
+				return nil, perr
+			}
+			coef[i] = a
+		}
+		for len(coef) > 0 && coef[0] == 0 {
+			coef = coef[1:]
+		}
+		if deg := len(coef) - 1; deg < minRoots || deg > maxRoots {
+			return nil, paramOutOfRange("coef must describe a polynomial of degree between %d and %d, got %d", minRoots, maxRoots, max(deg, 0))
+		}
+		return julia.PolynomialRoots(coef), nil
+	}
+	return julia.UnityRoots(defaultNewtonDegree), nil
+}
+
+// parseInterior parses the optional interior_value parameter. Any float32
+// value is accepted, including NaN and ±Inf; nil means the default sentinel.
+func parseInterior(q url.Values) (*float32, *paramError) {
+	is := q.Get("interior_value")
+	if is == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(is, 32)
+	if errors.Is(err, strconv.ErrRange) {
+		return nil, paramOutOfRange("interior_value %q is out of float32 range", is)
+	}
+	if err != nil {
+		return nil, invalidParam("invalid interior_value: %q is not a valid number", is)
+	}
+	f := float32(v)
+	return &f, nil
+}
+
+// parseBigFloat parses a number already validated by strconv.ParseFloat,
+// keeping enough precision for every digit of s.
+func parseBigFloat(s string) *big.Float {
+	prec := uint(len(s))*4 + 64
+	if prec > maxPrecision {
+		prec = maxPrecision
+	}
+	f, _, err := big.ParseFloat(s, 0, prec, big.ToNearestEven)
+	if err != nil {
+		// Only reachable for syntax strconv accepts and math/big does not;
+		// fall back to the float64 value.
+		v, _ := strconv.ParseFloat(s, 64)
+		f = big.NewFloat(v)
+	}
+	return f
+}
+
+// parsePrecision parses the optional precision parameter for the viewport in
+// p (whose Exact bounds must be set), returning the mantissa precision in
+// bits, or 0 for float64 arithmetic.
+func parsePrecision(q url.Values, p julia.Params, power float64) (uint, *paramError) {
+	integerPower := power == math.Trunc(power)
+
+	ps := q.Get("precision")
+	switch ps {
+	case "", precisionAuto:
+		need := julia.RequiredPrec(p.Exact, p.Width, p.Height)
+		if need+autoPrecisionSlack <= float64Mantissa || !integerPower {
+			return 0, nil
+		}
+		// Round up to whole 64-bit words with at least one word of headroom.
+		prec := (need + 64 + 63) / 64 * 64
+		if prec > maxPrecision {
+			return 0, paramOutOfRange("viewport needs %d bits of precision, maximum is %d", need, maxPrecision)
+		}
+		return prec, nil
+	case precisionFloat64:
+		return 0, nil
+	}
+
+	bits, err := strconv.Atoi(ps)
+	if err != nil {
+		return 0, invalidParam("invalid precision: %q must be %s, %s or a number of bits", ps, precisionAuto, precisionFloat64)
+	}
+	if bits < minPrecision || bits > maxPrecision {
+		return 0, paramOutOfRange("precision must be between %d and %d bits, got %d", minPrecision, maxPrecision, bits)
+	}
+	if !integerPower {
+		return 0, paramConflict("precision %d requires an integer power, got %v", bits, power)
+	}
+	return uint(bits), nil
+}
+
+// parseCompConst parses a complex constant in "real,imag" form.
+func parseCompConst(s string) (complex128, *paramError) {
+	return parseComplex("comp_const", s)
+}
+
+// parseComplex parses the complex number in "real,imag" form given as the
+// named parameter.
+func parseComplex(name, s string) (complex128, *paramError) {
+	parts := strings.SplitN(s, ",", 3)
+	if len(parts) != 2 {
+		return 0, invalidParam("invalid %s: %q must be two comma-separated numbers", name, s)
+	}
+	cReal, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || math.IsNaN(cReal) || math.IsInf(cReal, 0) {
+		return 0, invalidParam("invalid %s real part: %q is not a valid number", name, parts[0])
+	}
+	cImag, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || math.IsNaN(cImag) || math.IsInf(cImag, 0) {
+		return 0, invalidParam("invalid %s imaginary part: %q is not a valid number", name, parts[1])
+	}
+	return complex(cReal, cImag), nil
+}
+
+// parseMaxIter parses the optional max_iter parameter.
+func (l Limits) parseMaxIter(q url.Values) (int, *paramError) {
+	ms := q.Get("max_iter")
+	if ms == "" {
+		return l.DefaultMaxIter, nil
+	}
+	m, err := strconv.Atoi(ms)
+	if err != nil {
+		return 0, invalidParam("invalid max_iter: %q is not a valid integer", ms)
+	}
+	if m < minMaxIter || m > l.MaxMaxIter {
+		return 0, paramOutOfRange("max_iter must be between %d and %d, got %d", minMaxIter, l.MaxMaxIter, m)
+	}
+	return m, nil
+}
+
+// parseTileParams maps a z/x/y tile address onto the root tile viewport and
+// parses the remaining query parameters, returning julia.Params or an error.
+func (l Limits) parseTileParams(zStr, xStr, yStr string, q url.Values) (julia.Params, *paramError) {
+	z, err := strconv.Atoi(zStr)
+	if err != nil {
+		return julia.Params{}, invalidParam("invalid tile z: %q is not a valid integer", zStr)
+	}
+	if z < 0 || z > maxTileZoom {
+		return julia.Params{}, paramOutOfRange("tile z must be between 0 and %d, got %d", maxTileZoom, z)
+	}
+	n := new(big.Int).Lsh(big.NewInt(1), uint(z))
+	x, ok := new(big.Int).SetString(xStr, 10)
+	if !ok {
+		return julia.Params{}, invalidParam("invalid tile x: %q is not a valid integer", xStr)
+	}
+	if x.Sign() < 0 || x.Cmp(n) >= 0 {
+		return julia.Params{}, paramOutOfRange("tile x must be between 0 and %s at zoom %d, got %s", new(big.Int).Sub(n, big.NewInt(1)), z, x)
+	}
+	y, ok := new(big.Int).SetString(yStr, 10)
+	if !ok {
+		return julia.Params{}, invalidParam("invalid tile y: %q is not a valid integer", yStr)
+	}
+	if y.Sign() < 0 || y.Cmp(n) >= 0 {
+		return julia.Params{}, paramOutOfRange("tile y must be between 0 and %s at zoom %d, got %s", new(big.Int).Sub(n, big.NewInt(1)), z, y)
+	}
+
+	// The root span is a power of two, so tile bounds have at most z+3
+	// significant bits and are exact at this precision; deep tiles then
+	// take the math/big path like any deep viewport.
+	prec := uint(z) + 64
+	span := new(big.Float).SetPrec(prec).SetFloat64(tileRootSpan)
+	span.SetMantExp(span, -z)
+	tileBounds := func(i *big.Int, root float64) (lo, hi *big.Float) {
+		lo = new(big.Float).SetPrec(prec).SetInt(i)
+		lo.Mul(lo, span)
+		lo.Add(lo, big.NewFloat(root))
+		hi = new(big.Float).SetPrec(prec).Add(lo, span)
+		return lo, hi
+	}
+	exact := &julia.Viewport{}
+	exact.MinX, exact.MaxX = tileBounds(x, tileRootMinX)
+	exact.MinY, exact.MaxY = tileBounds(y, tileRootMinY)
+
+	p := julia.Params{
+		Width:  tileSize,
+		Height: tileSize,
+		Exact:  exact,
+	}
+	p.MinX, _ = exact.MinX.Float64()
+	p.MaxX, _ = exact.MaxX.Float64()
+	p.MinY, _ = exact.MinY.Float64()
+	p.MaxY, _ = exact.MaxY.Float64()
+	if perr := l.parseOptions(q, &p); perr != nil {
+		return julia.Params{}, perr
+	}
+	return p, nil
+}
+
+// parseFormat parses the optional format parameter, returning the output format or an error.
+// def is used when the parameter is absent.
+func parseFormat(q url.Values, def string) (string, *paramError) {
+	switch f := q.Get("format"); f {
+	case "":
+		return def, nil
+	case formatRaw:
+		return formatRaw, nil
+	case formatPNG:
+		return formatPNG, nil
+	case formatEnvelope:
+		return formatEnvelope, nil
+	default:
+		return "", invalidParam("invalid format: %q must be one of %s, %s, %s", f, formatRaw, formatPNG, formatEnvelope)
+	}
+}
+
+// parseAnimationParams parses an animation request, returning the render
+// parameters, the value of c for each frame and the frame delay, or an
+// error message.
+func (l Limits) parseAnimationParams(q url.Values) (julia.Params, []complex128, int, *paramError) {
+	if f := q.Get("fractal"); f != "" && f != julia.Julia.String() {
+		return julia.Params{}, nil, 0, invalidParam("invalid fractal: animations move comp_const and need %s, got %q", julia.Julia, f)
+	}
+	if f := q.Get("formula"); f == julia.Newton.String() {
+		return julia.Params{}, nil, 0, invalidParam("invalid formula: animations move comp_const, which formula %s does not use", julia.Newton)
+	}
+	// c comes from the path; a placeholder satisfies parseParams.
+	pq := url.Values{}
+	for k, v := range q {
+		pq[k] = v
+	}
+	pq.Set("comp_const", "0,0")
+	p, perr := l.parseParams(pq)
+	if perr != nil {
+		return julia.Params{}, nil, 0, perr
+	}
+
+	frames, perr := parseIntParam(q, "frames", defaultFrames, minFrames, maxFrames)
+	if perr != nil {
+		return julia.Params{}, nil, 0, perr
+	}
+	if pixels := p.Width * p.Height * frames; pixels > l.MaxAnimationPixels {
+		return julia.Params{}, nil, 0, paramOutOfRange("animation of %d frames at %dx%d is %d pixels, maximum is %d", frames, p.Width, p.Height, pixels, l.MaxAnimationPixels)
+	}
+	delay, perr := parseIntParam(q, "delay", defaultFrameDelay, minFrameDelay, maxFrameDelay)
+	if perr != nil {
+		return julia.Params{}, nil, 0, perr
+	}
+
+	cs, perr := parsePath(q, frames)
+	if perr != nil {
+		return julia.Params{}, nil, 0, perr
+	}
+	return p, cs, delay, nil
+}
+
+// parsePath parses the path parameter and the parameters of that path,
+// returning the value of c for each of n frames.
+func parsePath(q url.Values, n int) ([]complex128, *paramError) {
+	switch ps := q.Get("path"); ps {
+	case "":
+		return nil, missingParam("missing required parameter: path")
+
+	case pathCircle:
+		center, perr := parseRequiredComplex(q, "center")
+		if perr != nil {
+			return nil, perr
+		}
+		rs := q.Get("radius")
+		if rs == "" {
+			return nil, missingParam("missing required parameter: radius")
+		}
+		radius, err := strconv.ParseFloat(rs, 64)
+		if err != nil || math.IsNaN(radius) || math.IsInf(radius, 0) {
+			return nil, invalidParam("invalid radius: %q is not a valid number", rs)
+		}
+		if radius <= 0 {
+			return nil, paramOutOfRange("radius must be greater than 0, got %v", radius)
+		}
+		return animation.Circle(center, radius, n), nil
+
+	case pathLine:
+		from, perr := parseRequiredComplex(q, "from")
+		if perr != nil {
+			return nil, perr
+		}
+		to, perr := parseRequiredComplex(q, "to")
+		if perr != nil {
+			return nil, perr
+		}
+		return animation.Line(from, to, n), nil
+
+	case pathKeyframes:
+		// Points are repeated keyframe parameters: a semicolon-separated list
+		// would be rejected by the query string parser.
+		ks := q["keyframe"]
+		if len(ks) < 2 || len(ks) > maxKeyframes {
+			return nil, paramOutOfRange("keyframe must be given between 2 and %d times, got %d", maxKeyframes, len(ks))
+		}
+		points := make([]complex128, len(ks))
+		for i, s := range ks {
+			c, perr := parseComplex("keyframe", s)
+			if perr != nil {
+				return nil, perr
+			}
+			points[i] = c
+		}
+		return animation.Keyframes(points, n), nil
+
+	default:
+		return nil, invalidParam("invalid path: %q must be one of %s, %s, %s", ps, pathCircle, pathLine, pathKeyframes)
+	}
+}
+
+// parseRequiredComplex parses the named required parameter in "real,imag" form.
+func parseRequiredComplex(q url.Values, name string) (complex128, *paramError) {
+	s := q.Get(name)
+	if s == "" {
+		return 0, missingParam("missing required parameter: %s", name)
+	}
+	return parseComplex(name, s)
+}
+
+// parseIntParam parses the optional integer parameter name in [lo, hi],
+// returning def when it is absent.
+func parseIntParam(q url.Values, name string, def, lo, hi int) (int, *paramError) {
+	s := q.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, invalidParam("invalid %s: %q is not a valid integer", name, s)
+	}
+	if n < lo || n > hi {
+		return 0, paramOutOfRange("%s must be between %d and %d, got %d", name, lo, hi, n)
+	}
+	return n, nil
 }
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"encoding/binary"
+	"image/color"
+	"io"
+
+	"github.com/kqnade/julia-web-server/internal/colorize"
+	"github.com/kqnade/julia-web-server/internal/jobs"
+	"github.com/kqnade/julia-web-server/internal/julia"
+	"github.com/kqnade/julia-web-server/internal/pngstream"
+)
+
+// posterStripRows is the number of rows of a poster held in memory at once.
+const posterStripRows = 64
+
+// posterWriter returns the function that streams a poster of p in the given
+// format, formatPNG or formatRaw.
+func (s *Server) posterWriter(p julia.Params, format string) jobs.WriteFunc {
+	return func(ctx context.Context, w io.Writer, progress func()) error {
+		if format == formatRaw {
+			return s.renderer.RenderStrips(ctx, p, posterStripRows, func(_ int, strip []float32) error {
+				return binary.Write(w, binary.LittleEndian, strip)
+			}, progress)
+		}
+
+		pw, err := pngstream.NewWriter(w, p.Width, p.Height)
+		if err != nil {
+			return err
+		}
+		spacing := p.PixelSpacing()
+		pix := make([]byte, 0, posterStripRows*p.Width*3)
+		err = s.renderer.RenderStrips(ctx, p, posterStripRows, func(_ int, strip []float32) error {
+			pix = pix[:0]
+			for _, v := range strip {
+				var c color.RGBA
+				switch {
+				case p.Formula == julia.Newton:
+					c = colorize.Newton(v, len(p.Roots), p.MaxIter)
+				case p.Channel == julia.Distance:
+					c = colorize.Distance(v, spacing)
+				default:
+					c = colorize.Smooth(v)
+				}
+				pix = append(pix, c.R, c.G, c.B)
+			}
+			return pw.WriteRows(pix)
+		}, progress)
+		if err != nil {
+			return err
+		}
+		return pw.Close()
+	}
+}
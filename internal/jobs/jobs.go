@@ -0,0 +1,341 @@
+// Package jobs runs renders in the background so that clients can poll for
+// their progress and fetch the result later, independent of any single
+// HTTP request.
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+	"github.com/kqnade/julia-web-server/internal/pool"
+)
+
+// RetryInterval is how long a queued job waits before trying again when the
+// render pool is full.
+const RetryInterval = 250 * time.Millisecond
+
+// ErrTooManyJobs is returned by Submit when the manager already holds its
+// maximum number of jobs.
+var ErrTooManyJobs = errors.New("jobs: too many jobs")
+
+// ErrNotFound is returned for unknown or expired job IDs.
+var ErrNotFound = errors.New("jobs: no such job")
+
+// ErrNotDone is returned by Result while a job has not finished successfully.
+var ErrNotDone = errors.New("jobs: job has no result")
+
+// RenderFunc renders p, calling progress once per finished row.
+type RenderFunc func(ctx context.Context, p julia.Params, progress func()) ([]float32, error)
+
+// WriteFunc streams a render to w, calling progress once per finished row.
+type WriteFunc func(ctx context.Context, w io.Writer, progress func()) error
+
+// Status is the state of a job.
+type Status string
+
+const (
+	Queued  Status = "queued" // waiting for room in the render pool
+	Running Status = "running"
+	Done    Status = "done"
+	Failed  Status = "failed"
+)
+
+// Info is a snapshot of a job.
+type Info struct {
+	ID       string     `json:"id"`
+	Status   Status     `json:"status"`
+	Progress float64    `json:"progress"` // percent of rows finished
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// Output is the result of a finished job. Exactly one of Buf and File is
+// set, depending on how the job was submitted.
+type Output struct {
+	Params julia.Params
+	// Buf is the rendered buffer of a Submit job. It is shared and must not
+	// be modified.
+	Buf []float32
+	// File is the path of the file written by a SubmitFile job, and
+	// ContentType its media type. The file is removed when the job is.
+	File        string
+	ContentType string
+}
+
+// Manager is safe for concurrent use. Finished jobs are kept for a fixed
+// time after they finish and then removed.
+type Manager struct {
+	mu         sync.Mutex
+	jobs       map[string]*job
+	maxJobs    int
+	ttl        time.Duration
+	renderFunc RenderFunc
+	running    sync.WaitGroup
+}
+
+type job struct {
+	id          string
+	params      julia.Params
+	contentType string
+	rows        atomic.Int64
+	created     time.Time
+	cancel      context.CancelFunc
+
+	// Guarded by Manager.mu.
+	status   Status
+	err      error
+	finished time.Time
+	buf      []float32
+	file     string
+}
+
+// work produces the output of a job: a buffer or the path of a file.
+type work func(ctx context.Context, j *job) ([]float32, string, error)
+
+// New returns a manager holding at most maxJobs jobs, finished or not, each
+// kept for ttl after it finishes. Values of maxJobs below 1 are treated as 1.
+func New(maxJobs int, ttl time.Duration, render RenderFunc) *Manager {
+	if maxJobs < 1 {
+		maxJobs = 1
+	}
+	return &Manager{
+		jobs:       make(map[string]*job),
+		maxJobs:    maxJobs,
+		ttl:        ttl,
+		renderFunc: render,
+	}
+}
+
+// Submit starts rendering p in the background and returns the new job.
+func (m *Manager) Submit(p julia.Params) (Info, error) {
+	return m.start(p, "", func(ctx context.Context, j *job) ([]float32, string, error) {
+		buf, err := m.render(ctx, j)
+		return buf, "", err
+	})
+}
+
+// SubmitFile starts streaming a render of p to a temporary file with write,
+// for outputs too large to hold in memory, and returns the new job.
+// contentType is reported with the result.
+func (m *Manager) SubmitFile(p julia.Params, contentType string, write WriteFunc) (Info, error) {
+	return m.start(p, contentType, func(ctx context.Context, j *job) ([]float32, string, error) {
+		m.setStatus(j, Running)
+		file, err := writeFile(ctx, write, j.progress)
+		return nil, file, err
+	})
+}
+
+// start registers a job for p and runs do for it in the background.
+func (m *Manager) start(p julia.Params, contentType string, do work) (Info, error) {
+	id, err := newID()
+	if err != nil {
+		return Info{}, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{id: id, params: p, contentType: contentType, created: time.Now(), cancel: cancel, status: Queued}
+
+	m.mu.Lock()
+	if len(m.jobs) >= m.maxJobs {
+		m.mu.Unlock()
+		cancel()
+		return Info{}, ErrTooManyJobs
+	}
+	m.jobs[id] = j
+	info := m.info(j)
+	m.mu.Unlock()
+
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		buf, file, err := do(ctx, j)
+		m.finish(j, buf, file, err)
+	}()
+	return info, nil
+}
+
+// render renders j, retrying while the render pool is full.
+func (m *Manager) render(ctx context.Context, j *job) ([]float32, error) {
+	for {
+		m.setStatus(j, Running)
+		buf, err := m.renderFunc(ctx, j.params, j.progress)
+		if !errors.Is(err, pool.ErrQueueFull) {
+			return buf, err
+		}
+		m.setStatus(j, Queued)
+		select {
+		case <-time.After(RetryInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// writeFile runs write into a new temporary file and returns its path.
+func writeFile(ctx context.Context, write WriteFunc, progress func()) (string, error) {
+	f, err := os.CreateTemp("", "julia-job-*")
+	if err != nil {
+		return "", err
+	}
+	bw := bufio.NewWriter(f)
+	err = write(ctx, bw, progress)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func (j *job) progress() {
+	j.rows.Add(1)
+}
+
+func (m *Manager) setStatus(j *job, s Status) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j.status = s
+}
+
+// finish records the outcome of j and schedules its removal.
+func (m *Manager) finish(j *job, buf []float32, file string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobs[j.id] != j {
+		// Cancelled while running; nobody can fetch the output.
+		if file != "" {
+			os.Remove(file)
+		}
+		return
+	}
+	j.finished = time.Now()
+	if err != nil {
+		j.status = Failed
+		j.err = err
+	} else {
+		j.status = Done
+		j.buf = buf
+		j.file = file
+	}
+	time.AfterFunc(m.ttl, func() { m.remove(j) })
+}
+
+// remove drops j and its output file unless it has already been removed.
+func (m *Manager) remove(j *job) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobs[j.id] == j {
+		delete(m.jobs, j.id)
+		j.discard()
+	}
+}
+
+// discard deletes the output file of j, if any. Manager.mu must be held.
+func (j *job) discard() {
+	if j.file != "" {
+		os.Remove(j.file)
+		j.file = ""
+	}
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (m *Manager) Get(id string) (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Info{}, ErrNotFound
+	}
+	return m.info(j), nil
+}
+
+// Result returns the output of a finished job.
+func (m *Manager) Result(id string) (Output, Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Output{}, Info{}, ErrNotFound
+	}
+	info := m.info(j)
+	if j.status != Done {
+		return Output{}, info, ErrNotDone
+	}
+	return Output{Params: j.params, Buf: j.buf, File: j.file, ContentType: j.contentType}, info, nil
+}
+
+// Cancel removes the job with the given ID, stopping its render if it is
+// still running.
+func (m *Manager) Cancel(id string) error {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if ok {
+		delete(m.jobs, id)
+		j.discard()
+	}
+	m.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	j.cancel()
+	return nil
+}
+
+// Close cancels every job, waits for their renders to stop and removes
+// their files. It is meant to be called at shutdown, once no more jobs can
+// be submitted.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	all := m.jobs
+	m.jobs = make(map[string]*job)
+	for _, j := range all {
+		j.discard()
+	}
+	m.mu.Unlock()
+	for _, j := range all {
+		j.cancel()
+	}
+	m.running.Wait()
+}
+
+// info returns a snapshot of j. m.mu must be held.
+func (m *Manager) info(j *job) Info {
+	info := Info{ID: j.id, Status: j.status, Created: j.created}
+	if h := j.params.Height; h > 0 {
+		info.Progress = 100 * float64(j.rows.Load()) / float64(h)
+	}
+	if j.err != nil {
+		info.Error = j.err.Error()
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		info.Finished = &finished
+	}
+	if j.status == Done {
+		info.Progress = 100
+	}
+	return info
+}
+
+// newID returns a random 128-bit job ID in hex.
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,278 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+	"github.com/kqnade/julia-web-server/internal/pool"
+)
+
+var testParams = julia.Params{Width: 2, Height: 4}
+
+// fill returns a RenderFunc that reports every row and yields a buffer of v.
+func fill(v float32) RenderFunc {
+	return func(ctx context.Context, p julia.Params, progress func()) ([]float32, error) {
+		buf := make([]float32, p.Width*p.Height)
+		for i := range buf {
+			buf[i] = v
+		}
+		for range p.Height {
+			progress()
+		}
+		return buf, nil
+	}
+}
+
+// blocking returns a RenderFunc that reports half the rows and then waits
+// for ctx to be cancelled, signalling started once it is running.
+func blocking(started chan<- struct{}, stopped *atomic.Bool) RenderFunc {
+	return func(ctx context.Context, p julia.Params, progress func()) ([]float32, error) {
+		for range p.Height / 2 {
+			progress()
+		}
+		close(started)
+		<-ctx.Done()
+		stopped.Store(true)
+		return nil, ctx.Err()
+	}
+}
+
+// waitFor polls job id until it leaves the queued and running states.
+func waitFor(t *testing.T, m *Manager, id string) Info {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if info.Status != Queued && info.Status != Running {
+			return info
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("job did not finish")
+	return Info{}
+}
+
+func TestSubmit_Done(t *testing.T) {
+	m := New(4, time.Minute, fill(7))
+	info, err := m.Submit(testParams)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if info.ID == "" {
+		t.Fatal("Submit returned an empty ID")
+	}
+
+	info = waitFor(t, m, info.ID)
+	if info.Status != Done || info.Progress != 100 || info.Finished == nil {
+		t.Errorf("Info = %+v, want done at 100%% with a finish time", info)
+	}
+	out, _, err := m.Result(info.ID)
+	if err != nil {
+		t.Fatalf("Result: %v", err)
+	}
+	if len(out.Buf) != 8 || out.Buf[0] != 7 || out.Params.Key() != testParams.Key() || out.File != "" {
+		t.Errorf("Result = %+v, want 8 sevens for the submitted params", out)
+	}
+}
+
+func TestSubmitFile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	m := New(4, time.Minute, fill(0))
+	info, err := m.SubmitFile(testParams, "text/plain", func(ctx context.Context, w io.Writer, progress func()) error {
+		progress()
+		_, err := io.WriteString(w, "poster")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("SubmitFile: %v", err)
+	}
+
+	info = waitFor(t, m, info.ID)
+	if info.Status != Done {
+		t.Fatalf("Status = %s, want %s", info.Status, Done)
+	}
+	out, _, err := m.Result(info.ID)
+	if err != nil {
+		t.Fatalf("Result: %v", err)
+	}
+	if out.Buf != nil || out.ContentType != "text/plain" {
+		t.Errorf("Result = %+v, want a text/plain file", out)
+	}
+	data, err := os.ReadFile(out.File)
+	if err != nil || string(data) != "poster" {
+		t.Fatalf("file contents = %q, %v; want %q", data, err, "poster")
+	}
+
+	m.Cancel(info.ID)
+	if _, err := os.Stat(out.File); !os.IsNotExist(err) {
+		t.Errorf("file still exists after Cancel: %v", err)
+	}
+}
+
+func TestSubmitFile_FailureRemovesFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	m := New(4, time.Minute, fill(0))
+	info, _ := m.SubmitFile(testParams, "text/plain", func(ctx context.Context, w io.Writer, progress func()) error {
+		return errors.New("disk full")
+	})
+
+	info = waitFor(t, m, info.ID)
+	if info.Status != Failed || info.Error != "disk full" {
+		t.Errorf("Info = %+v, want failed with error disk full", info)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("temporary directory holds %d files, want none", len(entries))
+	}
+}
+
+func TestSubmit_Progress(t *testing.T) {
+	started := make(chan struct{})
+	var stopped atomic.Bool
+	m := New(4, time.Minute, blocking(started, &stopped))
+	info, _ := m.Submit(testParams)
+	<-started
+
+	info, err := m.Get(info.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if info.Status != Running || info.Progress != 50 {
+		t.Errorf("Info = %+v, want running at 50%%", info)
+	}
+	if _, _, err := m.Result(info.ID); !errors.Is(err, ErrNotDone) {
+		t.Errorf("Result err = %v, want ErrNotDone", err)
+	}
+	m.Cancel(info.ID)
+}
+
+func TestSubmit_Failed(t *testing.T) {
+	boom := errors.New("boom")
+	m := New(4, time.Minute, func(context.Context, julia.Params, func()) ([]float32, error) {
+		return nil, boom
+	})
+	info, _ := m.Submit(testParams)
+
+	info = waitFor(t, m, info.ID)
+	if info.Status != Failed || info.Error != "boom" {
+		t.Errorf("Info = %+v, want failed with error boom", info)
+	}
+	if _, _, err := m.Result(info.ID); !errors.Is(err, ErrNotDone) {
+		t.Errorf("Result err = %v, want ErrNotDone", err)
+	}
+}
+
+func TestSubmit_RetriesWhenQueueFull(t *testing.T) {
+	var calls atomic.Int32
+	m := New(4, time.Minute, func(ctx context.Context, p julia.Params, progress func()) ([]float32, error) {
+		if calls.Add(1) == 1 {
+			return nil, pool.ErrQueueFull
+		}
+		return fill(1)(ctx, p, progress)
+	})
+	info, _ := m.Submit(testParams)
+
+	info = waitFor(t, m, info.ID)
+	if info.Status != Done {
+		t.Errorf("Status = %s, want %s", info.Status, Done)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("render called %d times, want 2", n)
+	}
+}
+
+func TestSubmit_TooManyJobs(t *testing.T) {
+	started := make(chan struct{})
+	var stopped atomic.Bool
+	m := New(1, time.Minute, blocking(started, &stopped))
+	info, _ := m.Submit(testParams)
+	<-started
+	defer m.Cancel(info.ID)
+
+	if _, err := m.Submit(testParams); !errors.Is(err, ErrTooManyJobs) {
+		t.Errorf("second Submit err = %v, want ErrTooManyJobs", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	started := make(chan struct{})
+	var stopped atomic.Bool
+	m := New(4, time.Minute, blocking(started, &stopped))
+	info, _ := m.Submit(testParams)
+	<-started
+
+	if err := m.Cancel(info.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if _, err := m.Get(info.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Cancel err = %v, want ErrNotFound", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !stopped.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("render was not cancelled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := m.Cancel(info.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Cancel err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFinishedJobsExpire(t *testing.T) {
+	m := New(4, 10*time.Millisecond, fill(1))
+	info, _ := m.Submit(testParams)
+	waitFor(t, m, info.ID)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := m.Get(info.ID); errors.Is(err, ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("finished job was not removed after its TTL")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClose(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	started := make(chan struct{})
+	var stopped atomic.Bool
+	m := New(4, time.Minute, blocking(started, &stopped))
+	running, _ := m.Submit(testParams)
+	<-started
+	written := make(chan struct{})
+	file, _ := m.SubmitFile(testParams, "text/plain", func(ctx context.Context, w io.Writer, progress func()) error {
+		io.WriteString(w, "partial")
+		close(written)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-written
+
+	m.Close()
+
+	if !stopped.Load() {
+		t.Error("Close returned before the render stopped")
+	}
+	for _, id := range []string{running.ID, file.ID} {
+		if _, err := m.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%s) after Close err = %v, want ErrNotFound", id, err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("temporary directory holds %d files after Close, want none", len(entries))
+	}
+}
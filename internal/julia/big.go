@@ -0,0 +1,190 @@
+package julia
+
+import (
+	"math"
+	"math/big"
+)
+
+// Viewport holds exact viewport bounds for high-precision renders.
+type Viewport struct {
+	MinX, MaxX *big.Float
+	MinY, MaxY *big.Float
+}
+
+// ViewportOf returns the exact bounds of the float64 viewport of p.
+func ViewportOf(p Params) *Viewport {
+	return &Viewport{
+		MinX: big.NewFloat(p.MinX),
+		MaxX: big.NewFloat(p.MaxX),
+		MinY: big.NewFloat(p.MinY),
+		MaxY: big.NewFloat(p.MaxY),
+	}
+}
+
+// RequiredPrec returns the number of mantissa bits needed to tell adjacent
+// pixels of a width x height render of v apart: log2 of the largest
+// coordinate magnitude over the pixel spacing, rounded up.
+func RequiredPrec(v *Viewport, width, height int) uint {
+	spanX := new(big.Float).SetPrec(v.MaxX.Prec()+v.MinX.Prec()).Sub(v.MaxX, v.MinX)
+	spanY := new(big.Float).SetPrec(v.MaxY.Prec()+v.MinY.Prec()).Sub(v.MaxY, v.MinY)
+	dx, _ := spanX.Float64()
+	dy, _ := spanY.Float64()
+	spacing := math.Min(dx/float64(width), dy/float64(height))
+	if !(spacing > 0) {
+		return math.MaxUint32
+	}
+
+	mag := spacing
+	for _, f := range []*big.Float{v.MinX, v.MaxX, v.MinY, v.MaxY} {
+		m, _ := f.Float64()
+		mag = math.Max(mag, math.Abs(m))
+	}
+	return uint(math.Ceil(math.Log2(mag / spacing)))
+}
+
+// PixelToBig is PixelToComplex on the exact viewport v at precision prec.
+func PixelToBig(px, py, width, height int, v *Viewport, prec uint) (re, im *big.Float) {
+	if width <= 0 || height <= 0 {
+		panic("julia: PixelToBig called with non-positive dimensions")
+	}
+	re = new(big.Float).SetPrec(prec).Sub(v.MaxX, v.MinX)
+	re.Mul(re, new(big.Float).SetInt64(int64(px)))
+	re.Quo(re, new(big.Float).SetInt64(int64(width)))
+	re.Add(re, v.MinX)
+
+	im = new(big.Float).SetPrec(prec).Sub(v.MaxY, v.MinY)
+	im.Mul(im, new(big.Float).SetInt64(int64(py)))
+	im.Quo(im, new(big.Float).SetInt64(int64(height)))
+	im.Add(im, v.MinY)
+	return re, im
+}
+
+// bigComplex is a complex number with big.Float parts.
+type bigComplex struct {
+	re, im *big.Float
+}
+
+func newBigComplex(prec uint) bigComplex {
+	return bigComplex{re: new(big.Float).SetPrec(prec), im: new(big.Float).SetPrec(prec)}
+}
+
+// IterateBig is IteratePower, or for formula f IterateBurningShip or
+// IterateTricorn, for an integer degree d >= 2 with z0 and c given as
+// big.Float parts and all arithmetic done at precision prec. The escape
+// test and smooth count use float64 approximations of |z|, which are exact
+// enough near the escape radius.
+func IterateBig(z0Re, z0Im, cRe, cIm *big.Float, f Formula, d, maxIter int, escapeRadius float64, prec uint) (escaped bool, smooth float64, n int) {
+	z := newBigComplex(prec)
+	z.re.Set(z0Re)
+	z.im.Set(z0Im)
+	w := newBigComplex(prec)
+	t1 := new(big.Float).SetPrec(prec)
+	t2 := new(big.Float).SetPrec(prec)
+	er2 := escapeRadius * escapeRadius
+
+	for i := 0; i < maxIter; i++ {
+		zr, _ := z.re.Float64()
+		zi, _ := z.im.Float64()
+		mag2 := zr*zr + zi*zi
+
+		if !(mag2 <= er2) {
+			return true, SmoothCount(i, mag2, float64(d)), i
+		}
+
+		switch f {
+		case BurningShip:
+			z.re.Abs(z.re)
+			z.im.Abs(z.im)
+		case Tricorn:
+			z.im.Neg(z.im)
+		}
+
+		// w = z^d by repeated multiplication
+		w.re.Set(z.re)
+		w.im.Set(z.im)
+		for k := 1; k < d; k++ {
+			t1.Mul(w.re, z.im)
+			t2.Mul(w.im, z.re)
+			w.re.Mul(w.re, z.re)
+			w.im.Mul(w.im, z.im)
+			w.re.Sub(w.re, w.im)
+			w.im.Add(t1, t2)
+		}
+		z.re.Add(w.re, cRe)
+		z.im.Add(w.im, cIm)
+	}
+
+	return false, InteriorSentinel, maxIter
+}
+
+// IteratePhoenixBig is IteratePhoenix for an integer degree d >= 2 with
+// z0 and c given as big.Float parts and all arithmetic done at precision
+// prec, as for IterateBig. p is kept in float64 like Params.C.
+func IteratePhoenixBig(z0Re, z0Im, cRe, cIm *big.Float, p complex128, d, maxIter int, escapeRadius float64, prec uint) (escaped bool, smooth float64, n int) {
+	z := newBigComplex(prec)
+	z.re.Set(z0Re)
+	z.im.Set(z0Im)
+	prev := newBigComplex(prec)
+	w := newBigComplex(prec)
+	t1 := new(big.Float).SetPrec(prec)
+	t2 := new(big.Float).SetPrec(prec)
+	pRe := new(big.Float).SetPrec(prec).SetFloat64(real(p))
+	pIm := new(big.Float).SetPrec(prec).SetFloat64(imag(p))
+	er2 := escapeRadius * escapeRadius
+
+	for i := 0; i < maxIter; i++ {
+		zr, _ := z.re.Float64()
+		zi, _ := z.im.Float64()
+		mag2 := zr*zr + zi*zi
+
+		if !(mag2 <= er2) {
+			return true, SmoothCount(i, mag2, float64(d)), i
+		}
+
+		// w = z^d by repeated multiplication
+		w.re.Set(z.re)
+		w.im.Set(z.im)
+		for k := 1; k < d; k++ {
+			t1.Mul(w.re, z.im)
+			t2.Mul(w.im, z.re)
+			w.re.Mul(w.re, z.re)
+			w.im.Mul(w.im, z.im)
+			w.re.Sub(w.re, w.im)
+			w.im.Add(t1, t2)
+		}
+		w.re.Add(w.re, cRe)
+		w.im.Add(w.im, cIm)
+
+		// w += p·prev
+		t1.Mul(pRe, prev.re)
+		t2.Mul(pIm, prev.im)
+		w.re.Add(w.re, t1)
+		w.re.Sub(w.re, t2)
+		t1.Mul(pRe, prev.im)
+		t2.Mul(pIm, prev.re)
+		w.im.Add(w.im, t1)
+		w.im.Add(w.im, t2)
+
+		// Rotate prev <- z <- w; the old prev becomes scratch space.
+		prev, z, w = z, w, prev
+	}
+
+	return false, InteriorSentinel, maxIter
+}
+
+// EvaluateBig is Evaluate on the exact viewport, for pixel (px, py) of p.
+// p.Exact must be set and p.Degree() must be an integer.
+func EvaluateBig(px, py int, p Params) (escaped bool, smooth float64, n int) {
+	re, im := PixelToBig(px, py, p.Width, p.Height, p.Exact, p.Prec)
+	zero := new(big.Float)
+	cRe, cIm := big.NewFloat(real(p.C)), big.NewFloat(imag(p.C))
+
+	z0Re, z0Im := re, im
+	if p.Fractal == Mandelbrot {
+		z0Re, z0Im, cRe, cIm = zero, zero, re, im
+	}
+	if p.Formula == Phoenix {
+		return IteratePhoenixBig(z0Re, z0Im, cRe, cIm, p.P, int(p.Degree()), p.MaxIter, p.EscapeRadius, p.Prec)
+	}
+	return IterateBig(z0Re, z0Im, cRe, cIm, p.Formula, int(p.Degree()), p.MaxIter, p.EscapeRadius, p.Prec)
+}
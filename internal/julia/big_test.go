@@ -0,0 +1,139 @@
+package julia
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestIterateBig_MatchesIterate(t *testing.T) {
+	points := []complex128{0.3 + 0.5i, -0.8 + 0.1i, 1.2 - 0.4i, 0, 0.35 + 0.05i}
+	c := -0.7 + 0.27015i
+	for _, z0 := range points {
+		wantEscaped, wantSmooth, _ := Iterate(z0, c, 256, DefaultEscapeRadius)
+		escaped, smooth, _ := IterateBig(
+			big.NewFloat(real(z0)), big.NewFloat(imag(z0)),
+			big.NewFloat(real(c)), big.NewFloat(imag(c)),
+			Polynomial, 2, 256, DefaultEscapeRadius, 128)
+		if escaped != wantEscaped || math.Abs(smooth-wantSmooth) > 1e-6 {
+			t.Errorf("z0=%v: IterateBig = (%v, %v), Iterate = (%v, %v)", z0, escaped, smooth, wantEscaped, wantSmooth)
+		}
+	}
+}
+
+func TestIterateBig_MatchesIteratePower(t *testing.T) {
+	for _, d := range []int{3, 4, 5} {
+		z0, c := 0.4+0.3i, 0.1-0.2i
+		wantEscaped, wantSmooth, _ := IteratePower(z0, c, float64(d), 256, DefaultEscapeRadius)
+		escaped, smooth, _ := IterateBig(
+			big.NewFloat(real(z0)), big.NewFloat(imag(z0)),
+			big.NewFloat(real(c)), big.NewFloat(imag(c)),
+			Polynomial, d, 256, DefaultEscapeRadius, 128)
+		if escaped != wantEscaped || math.Abs(smooth-wantSmooth) > 1e-6 {
+			t.Errorf("d=%d: IterateBig = (%v, %v), IteratePower = (%v, %v)", d, escaped, smooth, wantEscaped, wantSmooth)
+		}
+	}
+}
+
+func TestIterateBig_MatchesFolded(t *testing.T) {
+	iterate := map[Formula]func(z0, c complex128, d float64, maxIter int, escapeRadius float64) (bool, float64, int){
+		BurningShip: IterateBurningShip,
+		Tricorn:     IterateTricorn,
+	}
+	for f, fn := range iterate {
+		for _, d := range []int{2, 3} {
+			for _, c := range []complex128{-0.4 + 0.6i, 1i, 0.5 + 0.5i, 0.3} {
+				z0 := 0.1 - 0.2i
+				wantEscaped, wantSmooth, wantN := fn(z0, c, float64(d), 256, DefaultEscapeRadius)
+				escaped, smooth, n := IterateBig(
+					big.NewFloat(real(z0)), big.NewFloat(imag(z0)),
+					big.NewFloat(real(c)), big.NewFloat(imag(c)),
+					f, d, 256, DefaultEscapeRadius, 128)
+				if escaped != wantEscaped || n != wantN || math.Abs(smooth-wantSmooth) > 1e-6 {
+					t.Errorf("%v d=%d c=%v: IterateBig = (%v, %v, %d), float64 = (%v, %v, %d)", f, d, c, escaped, smooth, n, wantEscaped, wantSmooth, wantN)
+				}
+			}
+		}
+	}
+}
+
+func TestIteratePhoenixBig_MatchesIteratePhoenix(t *testing.T) {
+	for _, d := range []int{2, 3} {
+		for _, p := range []complex128{-0.5, 0.3 - 0.2i, 1} {
+			for _, c := range []complex128{0.5667, -0.4 + 0.6i, 0.3} {
+				z0 := 0.1 - 0.2i
+				wantEscaped, wantSmooth, wantN := IteratePhoenix(z0, c, p, float64(d), 256, DefaultEscapeRadius)
+				escaped, smooth, n := IteratePhoenixBig(
+					big.NewFloat(real(z0)), big.NewFloat(imag(z0)),
+					big.NewFloat(real(c)), big.NewFloat(imag(c)),
+					p, d, 256, DefaultEscapeRadius, 128)
+				if escaped != wantEscaped || n != wantN || math.Abs(smooth-wantSmooth) > 1e-6 {
+					t.Errorf("d=%d p=%v c=%v: IteratePhoenixBig = (%v, %v, %d), float64 = (%v, %v, %d)", d, p, c, escaped, smooth, n, wantEscaped, wantSmooth, wantN)
+				}
+			}
+		}
+	}
+}
+
+func TestPixelToBig_MatchesPixelToComplex(t *testing.T) {
+	p := Params{MinX: -2, MaxX: 2, MinY: -1.5, MaxY: 1.5}
+	v := ViewportOf(p)
+	for _, px := range [][2]int{{0, 0}, {50, 50}, {99, 99}, {13, 71}} {
+		want := PixelToComplex(px[0], px[1], 100, 100, p)
+		re, im := PixelToBig(px[0], px[1], 100, 100, v, 128)
+		r, _ := re.Float64()
+		i, _ := im.Float64()
+		if math.Abs(r-real(want)) > 1e-12 || math.Abs(i-imag(want)) > 1e-12 {
+			t.Errorf("pixel %v = (%v, %v), want %v", px, r, i, want)
+		}
+	}
+}
+
+func TestPixelToBig_ResolvesBelowFloat64(t *testing.T) {
+	minX, _, _ := big.ParseFloat("-0.75", 10, 256, big.ToNearestEven)
+	maxX, _, _ := big.ParseFloat("-0.74999999999999999999999999", 10, 256, big.ToNearestEven)
+	v := &Viewport{MinX: minX, MaxX: maxX, MinY: big.NewFloat(0), MaxY: big.NewFloat(1e-25)}
+
+	a, _ := PixelToBig(0, 0, 4, 4, v, 256)
+	b, _ := PixelToBig(1, 0, 4, 4, v, 256)
+	if a.Cmp(b) == 0 {
+		t.Error("adjacent pixels map to the same coordinate")
+	}
+}
+
+func TestRequiredPrec(t *testing.T) {
+	tests := []struct {
+		name        string
+		p           Params
+		width       int
+		wantAtMost  uint
+		wantAtLeast uint
+	}{
+		{"default view", Params{MinX: -2, MaxX: 2, MinY: -1.5, MaxY: 1.5}, 256, 10, 5},
+		{"1e-13 span", Params{MinX: -0.75, MaxX: -0.75 + 1e-13, MinY: 0.1, MaxY: 0.1 + 1e-13}, 256, 53, 48},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RequiredPrec(ViewportOf(tt.p), tt.width, tt.width)
+			if got < tt.wantAtLeast || got > tt.wantAtMost {
+				t.Errorf("RequiredPrec = %d, want between %d and %d", got, tt.wantAtLeast, tt.wantAtMost)
+			}
+		})
+	}
+}
+
+func TestEvaluateBig_Mandelbrot(t *testing.T) {
+	p := Params{
+		Fractal: Mandelbrot, MinX: -1.5, MaxX: 0.5, MinY: -1, MaxY: 1,
+		Width: 4, Height: 4, MaxIter: 256, EscapeRadius: DefaultEscapeRadius, Prec: 128,
+	}
+	p.Exact = ViewportOf(p)
+	for py := 0; py < p.Height; py++ {
+		for px := 0; px < p.Width; px++ {
+			wantEscaped, _, _ := Evaluate(PixelToComplex(px, py, p.Width, p.Height, p), p)
+			if escaped, _, _ := EvaluateBig(px, py, p); escaped != wantEscaped {
+				t.Errorf("pixel (%d, %d): escaped = %v, want %v", px, py, escaped, wantEscaped)
+			}
+		}
+	}
+}
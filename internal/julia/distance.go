@@ -0,0 +1,77 @@
+package julia
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// IterateDistance iterates z^d + c like IteratePower while tracking the
+// derivative dz of the orbit. With wrtC the derivative is taken with respect
+// to c (dz0 = 0, dz' = d·z^(d-1)·dz + 1), as for the Mandelbrot set;
+// otherwise with respect to z0 (dz0 = 1, dz' = d·z^(d-1)·dz), as for Julia
+// sets. For escaped points it returns DistanceEstimate; for non-escaped
+// points it returns -1.0. n is the number of iterations performed, as for
+// Iterate.
+func IterateDistance(z0, c complex128, d float64, maxIter int, escapeRadius float64, wrtC bool) (escaped bool, dist float64, n int) {
+	z := z0
+	dz := complex(1, 0)
+	if wrtC {
+		dz = 0
+	}
+	er2 := escapeRadius * escapeRadius
+	k := int(d)
+	integer := float64(k) == d
+
+	for i := 0; i < maxIter; i++ {
+		zr := real(z)
+		zi := imag(z)
+		mag2 := zr*zr + zi*zi
+
+		if !(mag2 <= er2) {
+			return true, DistanceEstimate(mag2, dz), i
+		}
+
+		var zd1 complex128 // z^(d-1)
+		if integer {
+			zd1 = powInt(z, k-1)
+		} else {
+			zd1 = cmplx.Pow(z, complex(d-1, 0))
+		}
+		dz = complex(d, 0) * zd1 * dz
+		if wrtC {
+			dz++
+		}
+		z = zd1*z + c
+	}
+
+	return false, InteriorSentinel, maxIter
+}
+
+// DistanceEstimate returns the exterior distance estimate
+// |z|·ln|z| / (2·|dz|) for an escaped point with |z|^2 = mag2 and orbit
+// derivative dz. It is a lower bound on the distance to the set, up to a
+// factor of 4 when |z| is large. Overflowed values and escapes with |z| <= 1
+// give 0.
+func DistanceEstimate(mag2 float64, dz complex128) float64 {
+	if math.IsNaN(mag2) || math.IsInf(mag2, 0) {
+		return 0
+	}
+	mag := math.Sqrt(mag2)
+	dzAbs := cmplx.Abs(dz)
+	if mag <= 1 || math.IsNaN(dzAbs) || math.IsInf(dzAbs, 0) {
+		return 0
+	}
+	if dzAbs == 0 {
+		return math.Inf(1)
+	}
+	return 0.5 * mag * math.Log(mag) / dzAbs
+}
+
+// EvaluateDistance is Evaluate for the Distance channel. p.Formula must be
+// Polynomial.
+func EvaluateDistance(pt complex128, p Params) (escaped bool, dist float64, n int) {
+	if p.Fractal == Mandelbrot {
+		return IterateDistance(0, pt, p.Degree(), p.MaxIter, p.EscapeRadius, true)
+	}
+	return IterateDistance(pt, p.C, p.Degree(), p.MaxIter, p.EscapeRadius, false)
+}
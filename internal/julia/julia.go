@@ -1,14 +1,175 @@
 package julia
 
-import "math"
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
 
 const (
 	DefaultMaxIter      = 256
 	DefaultEscapeRadius = 2.0
+	DefaultPower        = 2.0
+
+	// DistanceEscapeRadius is the default bailout for the Distance channel.
+	// The estimate only becomes accurate once |z| is large.
+	DistanceEscapeRadius = 1000.0
+
+	// InteriorSentinel is the smooth value reported for points that never escape.
+	InteriorSentinel = -1.0
+)
+
+// Fractal selects which plane a render samples.
+type Fractal int
+
+const (
+	// Julia iterates each pixel z0 with the fixed constant Params.C.
+	Julia Fractal = iota
+	// Mandelbrot iterates from z0 = 0 with each pixel as c.
+	Mandelbrot
+)
+
+// String returns the API name of f.
+func (f Fractal) String() string {
+	switch f {
+	case Julia:
+		return "julia"
+	case Mandelbrot:
+		return "mandelbrot"
+	default:
+		return "Fractal(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+// ParseFractal returns the Fractal with API name s.
+func ParseFractal(s string) (Fractal, bool) {
+	switch s {
+	case "julia":
+		return Julia, true
+	case "mandelbrot":
+		return Mandelbrot, true
+	default:
+		return 0, false
+	}
+}
+
+// Channel selects the per-pixel value a render outputs.
+type Channel int
+
+const (
+	// Smooth is the smooth iteration count.
+	Smooth Channel = iota
+	// Distance is the exterior distance estimate to the set, in
+	// complex-plane units.
+	Distance
 )
 
+// String returns the API name of ch.
+func (ch Channel) String() string {
+	switch ch {
+	case Smooth:
+		return "smooth"
+	case Distance:
+		return "distance"
+	default:
+		return "Channel(" + strconv.Itoa(int(ch)) + ")"
+	}
+}
+
+// ParseChannel returns the Channel with API name s.
+func ParseChannel(s string) (Channel, bool) {
+	switch s {
+	case "smooth":
+		return Smooth, true
+	case "distance":
+		return Distance, true
+	default:
+		return 0, false
+	}
+}
+
+// Formula selects the map that is iterated.
+type Formula int
+
+const (
+	// Polynomial is z^d + c.
+	Polynomial Formula = iota
+	// BurningShip is (|Re z| + i|Im z|)^d + c.
+	BurningShip
+	// Tricorn is conj(z)^d + c, the Mandelbar or, for d > 2, a Multicorn.
+	Tricorn
+	// Newton is Newton's method for the polynomial with roots Params.Roots.
+	Newton
+	// Phoenix is z^d + c + P·z', where z' is the previous iterate.
+	Phoenix
+	// Exp, Sin and Cos are λ·exp(z), λ·sin(z) and λ·cos(z), with λ taking
+	// the place of c.
+	Exp
+	Sin
+	Cos
+	// Rational is z^d + c + Params.Lambda/z^m, with m = Params.PoleDegree().
+	Rational
+)
+
+// String returns the API name of f.
+func (f Formula) String() string {
+	switch f {
+	case Polynomial:
+		return "polynomial"
+	case BurningShip:
+		return "burning_ship"
+	case Tricorn:
+		return "tricorn"
+	case Newton:
+		return "newton"
+	case Phoenix:
+		return "phoenix"
+	case Exp:
+		return "exp"
+	case Sin:
+		return "sin"
+	case Cos:
+		return "cos"
+	case Rational:
+		return "rational"
+	default:
+		return "Formula(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+// ParseFormula returns the Formula with API name s.
+func ParseFormula(s string) (Formula, bool) {
+	switch s {
+	case "polynomial":
+		return Polynomial, true
+	case "burning_ship":
+		return BurningShip, true
+	case "tricorn":
+		return Tricorn, true
+	case "newton":
+		return Newton, true
+	case "phoenix":
+		return Phoenix, true
+	case "exp":
+		return Exp, true
+	case "sin":
+		return Sin, true
+	case "cos":
+		return Cos, true
+	case "rational":
+		return Rational, true
+	default:
+		return 0, false
+	}
+}
+
 // Params holds parameters for Julia set computation.
 type Params struct {
+	Fractal      Fractal
+	Formula      Formula
+	Channel      Channel
 	MinX, MaxX   float64
 	MinY, MaxY   float64
 	C            complex128
@@ -16,12 +177,98 @@ type Params struct {
 	Height       int
 	MaxIter      int
 	EscapeRadius float64
+	// Power is the degree d of z^d + c. Zero means 2.
+	Power float64
+	// Prec is the mantissa precision in bits of coordinates and iteration.
+	// Zero selects float64 arithmetic.
+	Prec uint
+	// Exact holds the viewport at full precision when Prec > 0;
+	// MinX..MaxY then hold the nearest float64 values.
+	Exact *Viewport
+	// Interior is the value rendered for points that never escape.
+	// Nil means InteriorSentinel.
+	Interior *float32
+	// Roots are the roots of the polynomial solved by the Newton formula.
+	Roots []complex128
+	// P is the coefficient of the previous iterate in the Phoenix formula.
+	P complex128
+	// Lambda is the coefficient of the pole of the Rational formula.
+	Lambda complex128
+	// PolePower is the degree m of the pole of the Rational formula. Zero
+	// means Degree().
+	PolePower int
+}
+
+// Degree returns the effective degree of the iterated polynomial.
+func (p Params) Degree() float64 {
+	if p.Power == 0 {
+		return DefaultPower
+	}
+	return p.Power
+}
+
+// PoleDegree returns the effective degree of the pole of the Rational
+// formula.
+func (p Params) PoleDegree() int {
+	if p.PolePower == 0 {
+		return int(p.Degree())
+	}
+	return p.PolePower
+}
+
+// InteriorValue returns the effective value rendered for interior points.
+func (p Params) InteriorValue() float32 {
+	if p.Interior == nil {
+		return InteriorSentinel
+	}
+	return *p.Interior
+}
+
+// PixelSpacing returns the larger of the horizontal and vertical distances
+// between adjacent pixel centres in the complex plane, taken from Exact when
+// it is in use.
+func (p Params) PixelSpacing() float64 {
+	spanX, spanY := p.MaxX-p.MinX, p.MaxY-p.MinY
+	if p.Prec > 0 && p.Exact != nil {
+		spanX, _ = new(big.Float).SetPrec(p.Prec).Sub(p.Exact.MaxX, p.Exact.MinX).Float64()
+		spanY, _ = new(big.Float).SetPrec(p.Prec).Sub(p.Exact.MaxY, p.Exact.MinY).Float64()
+	}
+	return math.Max(spanX/float64(p.Width), spanY/float64(p.Height))
+}
+
+// Key returns a canonical string form of p. Two Params have the same key
+// exactly when they render the same buffer.
+func (p Params) Key() string {
+	var b strings.Builder
+	for _, f := range []float64{p.MinX, p.MaxX, p.MinY, p.MaxY, real(p.C), imag(p.C), real(p.P), imag(p.P), real(p.Lambda), imag(p.Lambda), p.EscapeRadius, p.Degree()} {
+		b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		b.WriteByte(',')
+	}
+	// Compare interior values by bits so that NaN keys are stable.
+	for _, n := range []int{int(p.Fractal), int(p.Formula), int(p.Channel), p.Width, p.Height, p.MaxIter, int(p.Prec), int(math.Float32bits(p.InteriorValue())), p.PoleDegree()} {
+		b.WriteString(strconv.Itoa(n))
+		b.WriteByte(',')
+	}
+	for _, r := range p.Roots {
+		b.WriteString(strconv.FormatFloat(real(r), 'g', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(imag(r), 'g', -1, 64))
+		b.WriteByte(',')
+	}
+	if p.Prec > 0 && p.Exact != nil {
+		for _, f := range []*big.Float{p.Exact.MinX, p.Exact.MaxX, p.Exact.MinY, p.Exact.MaxY} {
+			b.WriteString(f.Text('p', 0))
+			b.WriteByte(',')
+		}
+	}
+	return b.String()
 }
 
 // Iterate performs the Julia set iteration starting from z0 with constant c.
-// It returns whether the point escaped and the smooth iteration count.
+// It returns whether the point escaped, the smooth iteration count and the
+// number of iterations performed, which is maxIter for non-escaped points.
 // For escaped points, smooth >= 0 (clamped). For non-escaped points, smooth is -1.0.
-func Iterate(z0, c complex128, maxIter int, escapeRadius float64) (escaped bool, smooth float64) {
+func Iterate(z0, c complex128, maxIter int, escapeRadius float64) (escaped bool, smooth float64, n int) {
 	z := z0
 	er2 := escapeRadius * escapeRadius
 
@@ -32,29 +279,126 @@ func Iterate(z0, c complex128, maxIter int, escapeRadius float64) (escaped bool,
 
 		// !(mag2 <= er2) catches both mag2 > er2 and NaN (from Inf-Inf overflow)
 		if !(mag2 <= er2) {
-			if math.IsNaN(mag2) || math.IsInf(mag2, 0) {
-				return true, 0
-			}
-			// Smooth coloring: iteration + 1 - log(log(|z|)) / log(2)
-			logMag := math.Log(mag2) / 2.0 // log(|z|) = log(mag2)/2
-			// logMag must be > 0 (i.e. |z| > 1) for the formula to be valid.
-			// With escapeRadius < 1, a point can escape with |z| <= 1, making
-			// logMag <= 0 and math.Log(logMag) = NaN. Fall back to integer count.
-			if logMag <= 0 {
-				smooth = float64(i)
-			} else {
-				smooth = float64(i) + 1.0 - math.Log(logMag)/math.Log(2.0)
-				if smooth < 0 {
-					smooth = 0
-				}
-			}
-			return true, smooth
+			return true, SmoothCount(i, mag2, 2), i
 		}
 
 		z = z*z + c
 	}
 
-	return false, -1.0
+	return false, InteriorSentinel, maxIter
+}
+
+// IteratePower is Iterate for z = z^d + c. Integer degrees use repeated
+// multiplication; other degrees use the principal branch of cmplx.Pow.
+// d must be > 1.
+func IteratePower(z0, c complex128, d float64, maxIter int, escapeRadius float64) (escaped bool, smooth float64, n int) {
+	z := z0
+	er2 := escapeRadius * escapeRadius
+	k := int(d)
+	integer := float64(k) == d
+
+	for i := 0; i < maxIter; i++ {
+		zr := real(z)
+		zi := imag(z)
+		mag2 := zr*zr + zi*zi
+
+		if !(mag2 <= er2) {
+			return true, SmoothCount(i, mag2, d), i
+		}
+
+		if integer {
+			z = powInt(z, k) + c
+		} else {
+			z = cmplx.Pow(z, complex(d, 0)) + c
+		}
+	}
+
+	return false, InteriorSentinel, maxIter
+}
+
+// SmoothCount returns the smooth iteration count for a point that escaped
+// at iteration i with |z|^2 = mag2 under a map of the given degree.
+// Overflowed (NaN or Inf) magnitudes count as 0.
+func SmoothCount(i int, mag2, degree float64) float64 {
+	if math.IsNaN(mag2) || math.IsInf(mag2, 0) {
+		return 0
+	}
+	// Smooth coloring: iteration + 1 - log(log(|z|)) / log(degree)
+	logMag := math.Log(mag2) / 2.0 // log(|z|) = log(mag2)/2
+	// logMag must be > 0 (i.e. |z| > 1) for the formula to be valid.
+	// With escapeRadius < 1, a point can escape with |z| <= 1, making
+	// logMag <= 0 and math.Log(logMag) = NaN. Fall back to integer count.
+	if logMag <= 0 {
+		return float64(i)
+	}
+	smooth := float64(i) + 1.0 - math.Log(logMag)/math.Log(degree)
+	if smooth < 0 {
+		smooth = 0
+	}
+	return smooth
+}
+
+// powInt returns z^n for n >= 1 by binary exponentiation.
+func powInt(z complex128, n int) complex128 {
+	result := complex(1, 0)
+	for n > 0 {
+		if n&1 == 1 {
+			result *= z
+		}
+		z *= z
+		n >>= 1
+	}
+	return result
+}
+
+// Evaluate iterates the point pt of the plane selected by p.Fractal under
+// the map selected by p.Formula and returns the same results as Iterate.
+// The Newton formula always iterates pt; escaped then reports convergence
+// and smooth is the NewtonValue of the root and convergence count. On the
+// Mandelbrot plane the Exp, Sin and Cos formulas start from the singular
+// point of their function, 0 or π/2, whose orbit starts at λ. The Rational
+// formula takes λ rather than c from the pixel there, and starts from its
+// RationalCriticalPoint. Its degree must be an integer.
+func Evaluate(pt complex128, p Params) (escaped bool, smooth float64, n int) {
+	if p.Formula == Newton {
+		root, s, n := IterateNewton(pt, p.Roots, p.MaxIter)
+		if root < 0 {
+			return false, InteriorSentinel, n
+		}
+		return true, NewtonValue(root, s, p.MaxIter), n
+	}
+	z0, c := pt, p.C
+	if p.Fractal == Mandelbrot {
+		z0, c = 0, pt
+	}
+	switch p.Formula {
+	case BurningShip:
+		return IterateBurningShip(z0, c, p.Degree(), p.MaxIter, p.EscapeRadius)
+	case Tricorn:
+		return IterateTricorn(z0, c, p.Degree(), p.MaxIter, p.EscapeRadius)
+	case Phoenix:
+		return IteratePhoenix(z0, c, p.P, p.Degree(), p.MaxIter, p.EscapeRadius)
+	case Exp:
+		return IterateExp(z0, c, p.MaxIter, p.EscapeRadius)
+	case Sin:
+		if p.Fractal == Mandelbrot {
+			z0 = math.Pi / 2
+		}
+		return IterateSin(z0, c, p.MaxIter, p.EscapeRadius)
+	case Cos:
+		return IterateCos(z0, c, p.MaxIter, p.EscapeRadius)
+	case Rational:
+		d, m := int(p.Degree()), p.PoleDegree()
+		lambda := p.Lambda
+		if p.Fractal == Mandelbrot {
+			z0, c, lambda = RationalCriticalPoint(pt, d, m), p.C, pt
+		}
+		return IterateRational(z0, c, lambda, d, m, p.MaxIter, p.EscapeRadius)
+	}
+	if d := p.Degree(); d != 2 {
+		return IteratePower(z0, c, d, p.MaxIter, p.EscapeRadius)
+	}
+	return Iterate(z0, c, p.MaxIter, p.EscapeRadius)
 }
 
 // PixelToComplex converts pixel coordinates (px, py) to a complex number
@@ -2,6 +2,7 @@ package julia
 
 import (
 	"math"
+	"math/cmplx"
 	"testing"
 )
 
@@ -97,7 +98,7 @@ func TestIterate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			escaped, smooth := Iterate(tt.z0, tt.c, tt.maxIter, tt.escapeRadius)
+			escaped, smooth, _ := Iterate(tt.z0, tt.c, tt.maxIter, tt.escapeRadius)
 
 			if escaped != tt.wantEscaped {
 				t.Errorf("escaped = %v, want %v", escaped, tt.wantEscaped)
@@ -116,6 +117,96 @@ func TestIterate(t *testing.T) {
 	}
 }
 
+func TestIteratePower(t *testing.T) {
+	tests := []struct {
+		name        string
+		z0, c       complex128
+		d           float64
+		wantEscaped bool
+	}{
+		{"cubic origin with zero c does not escape", 0, 0, 3, false},
+		{"cubic c=1 escapes from origin", 0, 1, 3, true},
+		{"cubic small real c does not escape", 0, -0.3, 3, false},
+		{"quartic point inside unit disk does not escape", 0.9 + 0.1i, 0, 4, false},
+		{"real degree point inside unit disk does not escape", 0.5 - 0.5i, 0, 2.5, false},
+		{"real degree large z escapes", 3 + 3i, 0, 2.5, true},
+		{"overflow to NaN is treated as escaped", 1e155 + 1e155i, 0, 7, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escaped, smooth, _ := IteratePower(tt.z0, tt.c, tt.d, 256, DefaultEscapeRadius)
+			if escaped != tt.wantEscaped {
+				t.Errorf("escaped = %v, want %v", escaped, tt.wantEscaped)
+			}
+			if escaped && (smooth < 0 || math.IsNaN(smooth) || math.IsInf(smooth, 0)) {
+				t.Errorf("smooth = %v, want finite non-negative value", smooth)
+			}
+			if !escaped && smooth != InteriorSentinel {
+				t.Errorf("smooth = %v, want %v", smooth, InteriorSentinel)
+			}
+		})
+	}
+}
+
+func TestIteratePower_SmoothUsesDegree(t *testing.T) {
+	// z0 = 10 escapes before the first step, so smooth = 1 - log(log 10)/log(d).
+	for _, d := range []float64{3, 5, 2.5} {
+		_, smooth, _ := IteratePower(10, 0, d, 256, DefaultEscapeRadius)
+		want := 1 - math.Log(math.Log(10))/math.Log(d)
+		if math.Abs(smooth-want) > 1e-12 {
+			t.Errorf("d=%v: smooth = %v, want %v", d, smooth, want)
+		}
+	}
+}
+
+func TestIteratePower_DegreeTwoMatchesIterate(t *testing.T) {
+	points := []complex128{0.3 + 0.5i, -0.8 + 0.1i, 1.2 - 0.4i, 0}
+	for _, z0 := range points {
+		e1, s1, _ := Iterate(z0, -0.7+0.27015i, 256, DefaultEscapeRadius)
+		e2, s2, _ := IteratePower(z0, -0.7+0.27015i, 2, 256, DefaultEscapeRadius)
+		if e1 != e2 || s1 != s2 {
+			t.Errorf("z0=%v: IteratePower = (%v, %v), Iterate = (%v, %v)", z0, e2, s2, e1, s1)
+		}
+	}
+}
+
+func TestIterate_IterationCount(t *testing.T) {
+	tests := []struct {
+		name string
+		z0   complex128
+		want int
+	}{
+		{"escaped at start", 10, 0},
+		{"escapes after one step", 1.5, 1}, // 1.5² = 2.25 > 2
+		{"interior", 0, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, n := Iterate(tt.z0, 0, 50, DefaultEscapeRadius)
+			if n != tt.want {
+				t.Errorf("Iterate n = %d, want %d", n, tt.want)
+			}
+			if _, _, n := IteratePower(tt.z0, 0, 2, 50, DefaultEscapeRadius); n != tt.want {
+				t.Errorf("IteratePower n = %d, want %d", n, tt.want)
+			}
+			if _, _, n := IterateDistance(tt.z0, 0, 2, 50, DefaultEscapeRadius, false); n != tt.want {
+				t.Errorf("IterateDistance n = %d, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestPowInt(t *testing.T) {
+	z := 1.5 - 0.5i
+	for n := 1; n <= 9; n++ {
+		want := cmplx.Pow(z, complex(float64(n), 0))
+		if got := powInt(z, n); cmplx.Abs(got-want) > 1e-9*cmplx.Abs(want) {
+			t.Errorf("powInt(%v, %d) = %v, want %v", z, n, got, want)
+		}
+	}
+}
+
 func TestPixelToComplex(t *testing.T) {
 	p := Params{
 		MinX: -2,
@@ -186,3 +277,626 @@ func TestPixelToComplex(t *testing.T) {
 		})
 	}
 }
+
+func TestParamsKey(t *testing.T) {
+	base := Params{
+		MinX: -2, MaxX: 2, MinY: -1.5, MaxY: 1.5,
+		C:     -0.7 + 0.27015i,
+		Width: 256, Height: 256, MaxIter: 256,
+		EscapeRadius: DefaultEscapeRadius,
+	}
+	if base.Key() != base.Key() {
+		t.Fatal("Key is not deterministic")
+	}
+
+	variants := []func(*Params){
+		func(p *Params) { p.MinX = -2.5 },
+		func(p *Params) { p.MaxY = 1.25 },
+		func(p *Params) { p.C = -0.7 - 0.27015i },
+		func(p *Params) { p.Width, p.Height = p.Height+1, p.Width },
+		func(p *Params) { p.MaxIter++ },
+		func(p *Params) { p.EscapeRadius = 4 },
+		func(p *Params) { p.Fractal = Mandelbrot },
+		func(p *Params) { p.Power = 3 },
+		func(p *Params) { p.Formula = BurningShip },
+		func(p *Params) { p.Roots = UnityRoots(3) },
+		func(p *Params) { p.P = -0.5 },
+		func(p *Params) { p.P = 0.5i },
+		func(p *Params) { p.Lambda = 0.01 },
+		func(p *Params) { p.PolePower = 3 },
+		func(p *Params) { p.Channel = Distance },
+		func(p *Params) { v := float32(0); p.Interior = &v },
+		func(p *Params) { p.Prec, p.Exact = 128, ViewportOf(*p) },
+	}
+	for i, mutate := range variants {
+		p := base
+		mutate(&p)
+		if p.Key() == base.Key() {
+			t.Errorf("variant %d: key %q equals base key", i, p.Key())
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name        string
+		pt          complex128
+		p           Params
+		wantEscaped bool
+	}{
+		{"julia uses pixel as z0", 10, Params{Fractal: Julia, C: 0}, true},
+		{"julia uses fixed c", 0, Params{Fractal: Julia, C: -1}, false},
+		{"mandelbrot main cardioid is interior", -0.1 + 0.1i, Params{Fractal: Mandelbrot}, false},
+		{"mandelbrot period-2 bulb is interior", -1, Params{Fractal: Mandelbrot}, false},
+		{"mandelbrot c=1 escapes", 1, Params{Fractal: Mandelbrot}, true},
+		{"mandelbrot ignores fixed c", -1, Params{Fractal: Mandelbrot, C: 10}, false},
+		{"mandelbrot c=i is interior", 1i, Params{Fractal: Mandelbrot}, false},
+		{"burning ship c=i escapes", 1i, Params{Fractal: Mandelbrot, Formula: BurningShip}, true},
+		{"burning ship julia uses pixel as z0", 1i, Params{Fractal: Julia, Formula: BurningShip, C: 1i}, true},
+		{"burning ship julia uses fixed c", 0, Params{Fractal: Julia, Formula: BurningShip, C: -1i}, false},
+		{"tricorn c=i escapes", 1i, Params{Fractal: Mandelbrot, Formula: Tricorn}, true},
+		{"tricorn c=-1 is interior", -1, Params{Fractal: Mandelbrot, Formula: Tricorn}, false},
+		{"phoenix p=0 c=-1 is interior", -1, Params{Fractal: Mandelbrot, Formula: Phoenix}, false},
+		{"phoenix julia uses p", 1, Params{Fractal: Julia, Formula: Phoenix, P: 1}, true},
+		{"phoenix julia uses fixed c", 0, Params{Fractal: Julia, Formula: Phoenix, C: 1, P: -0.5}, true},
+		{"exp mandelbrot λ=0.3 is interior", 0.3, Params{Fractal: Mandelbrot, Formula: Exp}, false},
+		{"exp mandelbrot λ=1 escapes", 1, Params{Fractal: Mandelbrot, Formula: Exp}, true},
+		{"exp julia uses fixed λ", 0, Params{Fractal: Julia, Formula: Exp, C: 1}, true},
+		// From 0, λ·sin would stay at 0 and every λ would be interior.
+		{"sin mandelbrot starts at π/2", 2 + 2i, Params{Fractal: Mandelbrot, Formula: Sin}, true},
+		{"sin mandelbrot λ=1 is interior", 1, Params{Fractal: Mandelbrot, Formula: Sin}, false},
+		{"cos mandelbrot λ=3i escapes", 3i, Params{Fractal: Mandelbrot, Formula: Cos}, true},
+		{"rational julia uses λ", 0, Params{Fractal: Julia, Formula: Rational, Lambda: 0.01}, true},
+		{"rational julia with λ=0 is polynomial", 0, Params{Fractal: Julia, Formula: Rational}, false},
+		{"rational mandelbrot uses pixel as λ", 1, Params{Fractal: Mandelbrot, Formula: Rational}, true},
+		{"rational mandelbrot uses fixed c", 1e-6, Params{Fractal: Mandelbrot, Formula: Rational, C: -0.1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.p.MaxIter = 256
+			tt.p.EscapeRadius = DefaultEscapeRadius
+			if tt.p.Formula == Exp || tt.p.Formula == Sin || tt.p.Formula == Cos {
+				tt.p.EscapeRadius = TranscendentalEscapeRadius
+			}
+			escaped, smooth, _ := Evaluate(tt.pt, tt.p)
+			if escaped != tt.wantEscaped {
+				t.Errorf("escaped = %v, want %v", escaped, tt.wantEscaped)
+			}
+			if !escaped && smooth != InteriorSentinel {
+				t.Errorf("smooth = %v, want %v", smooth, InteriorSentinel)
+			}
+		})
+	}
+}
+
+func TestParseFractal(t *testing.T) {
+	for _, f := range []Fractal{Julia, Mandelbrot} {
+		got, ok := ParseFractal(f.String())
+		if !ok || got != f {
+			t.Errorf("ParseFractal(%q) = %v, %v; want %v, true", f.String(), got, ok, f)
+		}
+	}
+	if _, ok := ParseFractal("burning"); ok {
+		t.Error("ParseFractal accepted an unknown name")
+	}
+}
+
+func TestParseFormula(t *testing.T) {
+	for _, f := range []Formula{Polynomial, BurningShip, Tricorn, Newton, Phoenix, Exp, Sin, Cos, Rational} {
+		got, ok := ParseFormula(f.String())
+		if !ok || got != f {
+			t.Errorf("ParseFormula(%q) = %v, %v; want %v, true", f.String(), got, ok, f)
+		}
+	}
+	if _, ok := ParseFormula("julia"); ok {
+		t.Error("ParseFormula accepted an unknown name")
+	}
+}
+
+func TestIterateFolded(t *testing.T) {
+	// Orbits worked by hand from z0 = 0. The Burning Ship and Tricorn agree
+	// with z^2 + c on the real axis and part ways from it elsewhere: c = i
+	// is a preperiodic point of the Mandelbrot set, but both folded maps
+	// send it to 3i, which escapes.
+	tests := []struct {
+		name        string
+		iterate     func(z0, c complex128, d float64, maxIter int, escapeRadius float64) (bool, float64, int)
+		c           complex128
+		d           float64
+		wantEscaped bool
+		wantN       int
+		wantMag2    float64 // |z|^2 at escape
+	}{
+		// i, -1+i, (1+i)^2+i = 3i
+		{"burning ship c=i", IterateBurningShip, 1i, 2, true, 3, 9},
+		// -i, -1-i, (1+i)^2-i = i, -1-i, ... a 2-cycle
+		{"burning ship c=-i", IterateBurningShip, -1i, 2, false, 100, 0},
+		{"burning ship real axis interior", IterateBurningShip, -1.75, 2, false, 100, 0},
+		// 0.5, 0.75, 1.0625, 1.63..., 3.15...
+		{"burning ship real axis escapes", IterateBurningShip, 0.5, 2, true, 5, 0},
+		// i, (i)^3 + i = 0, i, ... a 2-cycle
+		{"burning ship cubic c=i", IterateBurningShip, 1i, 3, false, 100, 0},
+		// i, (-i)^2+i = -1+i, (-1-i)^2+i = 3i
+		{"tricorn c=i", IterateTricorn, 1i, 2, true, 3, 9},
+		{"tricorn c=-i", IterateTricorn, -1i, 2, true, 3, 9},
+		// -1, 0, -1, ...
+		{"tricorn c=-1", IterateTricorn, -1, 2, false, 100, 0},
+		// i, (-i)^3+i = 2i, (-2i)^3+i = 9i
+		{"tricorn cubic c=i", IterateTricorn, 1i, 3, true, 3, 81},
+		{"tricorn non-integer power", IterateTricorn, 0.1, 2.5, false, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escaped, smooth, n := tt.iterate(0, tt.c, tt.d, 100, DefaultEscapeRadius)
+			if escaped != tt.wantEscaped || n != tt.wantN {
+				t.Fatalf("got (%v, %v, %d), want escaped=%v n=%d", escaped, smooth, n, tt.wantEscaped, tt.wantN)
+			}
+			switch {
+			case !escaped:
+				if smooth != InteriorSentinel {
+					t.Errorf("smooth = %v, want %v", smooth, InteriorSentinel)
+				}
+			case tt.wantMag2 > 0:
+				if want := SmoothCount(n, tt.wantMag2, tt.d); math.Abs(smooth-want) > 1e-12 {
+					t.Errorf("smooth = %v, want %v", smooth, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIterateFolded_MatchesIterateOnRealAxis(t *testing.T) {
+	for _, c := range []complex128{-2, -1.75, -0.5, 0.25, 0.26, 1} {
+		wantEscaped, wantSmooth, wantN := Iterate(0, c, 256, DefaultEscapeRadius)
+		for name, iterate := range map[string]func(z0, c complex128, d float64, maxIter int, escapeRadius float64) (bool, float64, int){
+			"burning ship": IterateBurningShip,
+			"tricorn":      IterateTricorn,
+		} {
+			escaped, smooth, n := iterate(0, c, 2, 256, DefaultEscapeRadius)
+			if escaped != wantEscaped || n != wantN || math.Abs(smooth-wantSmooth) > 1e-9 {
+				t.Errorf("%s c=%v: got (%v, %v, %d), Iterate = (%v, %v, %d)", name, c, escaped, smooth, n, wantEscaped, wantSmooth, wantN)
+			}
+		}
+	}
+}
+
+func TestIteratePhoenix(t *testing.T) {
+	tests := []struct {
+		name        string
+		z0, c, p    complex128
+		wantEscaped bool
+		wantN       int
+	}{
+		// z = 1 is fixed under z^2 without memory; p = 1 adds the previous
+		// iterate: 1, 1, 2, 5.
+		{"memory escapes fixed point", 1, 0, 1, true, 3},
+		// p = -1 subtracts it: 1, 1, 0, -1, 1, 2, 3.
+		{"negative memory", 1, 0, -1, true, 6},
+		{"origin with c=0 is fixed", 0, 0, 0.5, false, 100},
+		// 0, 1, 2, 4.5.
+		{"real c escapes", 0, 1, -0.5, true, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escaped, smooth, n := IteratePhoenix(tt.z0, tt.c, tt.p, 2, 100, DefaultEscapeRadius)
+			if escaped != tt.wantEscaped || n != tt.wantN {
+				t.Errorf("got (%v, %d), want (%v, %d)", escaped, n, tt.wantEscaped, tt.wantN)
+			}
+			if !escaped && smooth != InteriorSentinel {
+				t.Errorf("smooth = %v, want %v", smooth, InteriorSentinel)
+			}
+			if escaped && !(smooth >= 0) {
+				t.Errorf("smooth = %v, want >= 0", smooth)
+			}
+		})
+	}
+}
+
+func TestIteratePhoenix_ZeroMemoryMatchesIteratePower(t *testing.T) {
+	for _, d := range []float64{2, 3, 2.5} {
+		for _, c := range []complex128{-0.7 + 0.27015i, -1, 0.26, 1i} {
+			z0 := 0.1 - 0.2i
+			wantEscaped, wantSmooth, wantN := IteratePower(z0, c, d, 256, DefaultEscapeRadius)
+			escaped, smooth, n := IteratePhoenix(z0, c, 0, d, 256, DefaultEscapeRadius)
+			if escaped != wantEscaped || n != wantN || smooth != wantSmooth {
+				t.Errorf("d=%v c=%v: got (%v, %v, %d), IteratePower = (%v, %v, %d)", d, c, escaped, smooth, n, wantEscaped, wantSmooth, wantN)
+			}
+		}
+	}
+}
+
+func TestIterateTranscendental(t *testing.T) {
+	iterate := map[Formula]func(z0, lambda complex128, maxIter int, escapeRadius float64) (bool, float64, int){
+		Exp: IterateExp,
+		Sin: IterateSin,
+		Cos: IterateCos,
+	}
+	tests := []struct {
+		name         string
+		f            Formula
+		z0, lambda   complex128
+		escapeRadius float64
+		wantEscaped  bool
+		wantN        int
+		wantSmooth   float64 // checked when >= 0
+	}{
+		// λ < 1/e has an attracting fixed point; λ = 1 does not, and the
+		// orbit of 0 is 1, e, e^e, e^(e^e).
+		{"exp attracting", Exp, 0, 0.3, 50, false, 100, -1},
+		{"exp λ=1 escapes", Exp, 0, 1, 50, true, 4, -1},
+		{"exp escapes at once", Exp, 100, 1, 50, true, 0, 1},
+		{"exp far left is not escaping", Exp, -1000, 0.3, 50, false, 100, -1},
+		{"exp large imaginary part is not escaping", Exp, 1000i, 0.3, 50, false, 100, -1},
+		// e^(e^(e^e)) overflows to Inf and then NaN, which must still
+		// escape with a finite count.
+		{"exp overflow", Exp, 0, 1, 1e100, true, 5, 5},
+		// 0 is a neutral fixed point of sin, and 0.739 an attracting one
+		// of cos.
+		{"sin neutral", Sin, 0, 1, 50, false, 100, -1},
+		{"sin λ=1 real axis", Sin, 1, 1, 50, false, 100, -1},
+		{"sin imaginary escapes", Sin, 3i, 1, 50, true, 2, -1},
+		{"sin escapes below", Sin, -60i, 1, 50, true, 0, 1},
+		{"cos attracting", Cos, 0, 1, 50, false, 100, -1},
+		{"cos λ=3i escapes", Cos, 0, 3i, 50, true, 3, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escaped, smooth, n := iterate[tt.f](tt.z0, tt.lambda, 100, tt.escapeRadius)
+			if escaped != tt.wantEscaped || n != tt.wantN {
+				t.Errorf("got (%v, %d), want (%v, %d)", escaped, n, tt.wantEscaped, tt.wantN)
+			}
+			switch {
+			case !escaped && smooth != InteriorSentinel:
+				t.Errorf("smooth = %v, want %v", smooth, InteriorSentinel)
+			case escaped && tt.wantSmooth >= 0 && smooth != tt.wantSmooth:
+				t.Errorf("smooth = %v, want %v", smooth, tt.wantSmooth)
+			case escaped && !(smooth >= float64(n) && smooth <= float64(n+1)):
+				t.Errorf("smooth = %v, want in [%d, %d]", smooth, n, n+1)
+			}
+		})
+	}
+}
+
+func TestIterateExp_SmoothIsContinuous(t *testing.T) {
+	// With λ = 1 every real point escapes, after more iterations the
+	// further left it starts.
+	prev := -1.0
+	for x := -2.0; x <= 60; x += 1e-3 {
+		escaped, smooth, _ := IterateExp(complex(x, 0), 1, 100, TranscendentalEscapeRadius)
+		if !escaped {
+			t.Fatalf("x=%v did not escape", x)
+		}
+		if prev >= 0 && math.Abs(smooth-prev) > 0.05 {
+			t.Errorf("x=%v: smooth jumps from %v to %v", x, prev, smooth)
+		}
+		prev = smooth
+	}
+}
+
+func TestIterateRational(t *testing.T) {
+	tests := []struct {
+		name         string
+		z0, c, l     complex128
+		n, m         int
+		maxIter      int
+		escapeRadius float64
+		wantEscaped  bool
+		wantN        int
+		wantSmooth   float64 // checked when >= 0
+	}{
+		// 0 is the pole: it maps to infinity, so the iteration from it
+		// escapes, even when it is the last one.
+		{"pole escapes", 0, 0, 0.01, 2, 2, 100, 2, true, 1, 0},
+		{"pole on the only iteration", 0, 0, 0.01, 2, 2, 1, 2, true, 1, 0},
+		// 1 + (-2) + 1/1 = 0, so the second iteration starts at the pole.
+		{"pole on the last iteration", 1, -2, 1, 2, 2, 2, 2, true, 2, 0},
+		{"pole reached after the last iteration", 1, -2, 1, 2, 2, 1, 2, false, 1, -1},
+		{"near the pole escapes", 1e-5, 0, 0.01, 2, 2, 100, 2, true, 1, -1},
+		// z^2 underflows to 0, which must not divide into NaN.
+		{"z^m underflows", 1e-200, 0, 0.01, 2, 2, 100, 2, true, 1, 0},
+		// λ/z^2 overflows to Inf.
+		{"pole term overflows", 1e-160, 0, 1e10, 2, 2, 100, 1e100, true, 1, 0},
+		{"λ=0 has no pole", 0, 0, 0, 2, 2, 100, 2, false, 100, -1},
+		// A small perturbation keeps the attracting fixed point of
+		// z^2 - 0.1.
+		{"perturbed attracting fixed point", 0.1 + 0.1i, -0.1, 1e-6, 2, 2, 100, 2, false, 100, -1},
+		{"escapes by growth", 1.5, 0, 0.01, 2, 1, 100, 2, true, 1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escaped, smooth, n := IterateRational(tt.z0, tt.c, tt.l, tt.n, tt.m, tt.maxIter, tt.escapeRadius)
+			if escaped != tt.wantEscaped || n != tt.wantN {
+				t.Errorf("got (%v, %d), want (%v, %d)", escaped, n, tt.wantEscaped, tt.wantN)
+			}
+			switch {
+			case !escaped && smooth != InteriorSentinel:
+				t.Errorf("smooth = %v, want %v", smooth, InteriorSentinel)
+			case escaped && tt.wantSmooth >= 0 && smooth != tt.wantSmooth:
+				t.Errorf("smooth = %v, want %v", smooth, tt.wantSmooth)
+			case escaped && !(smooth >= 0):
+				t.Errorf("smooth = %v, want >= 0", smooth)
+			}
+		})
+	}
+}
+
+func TestIterateRational_ZeroLambdaMatchesIteratePower(t *testing.T) {
+	for _, d := range []int{2, 3} {
+		for _, c := range []complex128{-0.7 + 0.27015i, -1, 0.26, 1i} {
+			for _, z0 := range []complex128{0, 0.1 - 0.2i} {
+				wantEscaped, wantSmooth, wantN := IteratePower(z0, c, float64(d), 256, DefaultEscapeRadius)
+				escaped, smooth, n := IterateRational(z0, c, 0, d, 2, 256, DefaultEscapeRadius)
+				if escaped != wantEscaped || n != wantN || smooth != wantSmooth {
+					t.Errorf("d=%d c=%v z0=%v: got (%v, %v, %d), IteratePower = (%v, %v, %d)", d, c, z0, escaped, smooth, n, wantEscaped, wantSmooth, wantN)
+				}
+			}
+		}
+	}
+}
+
+func TestRationalCriticalPoint(t *testing.T) {
+	for _, tt := range []struct {
+		lambda complex128
+		n, m   int
+	}{
+		{0.01, 2, 2},
+		{-0.3 + 0.2i, 3, 3},
+		{1i, 2, 1},
+		{2, 4, 3},
+	} {
+		z := RationalCriticalPoint(tt.lambda, tt.n, tt.m)
+		// f'(z) = n·z^(n-1) - m·λ/z^(m+1)
+		df := complex(float64(tt.n), 0)*powInt(z, tt.n-1) - complex(float64(tt.m), 0)*tt.lambda/powInt(z, tt.m+1)
+		if cmplx.Abs(df) > 1e-9 {
+			t.Errorf("λ=%v n=%d m=%d: f'(%v) = %v, want 0", tt.lambda, tt.n, tt.m, z, df)
+		}
+	}
+	if z := RationalCriticalPoint(0, 2, 2); z != 0 {
+		t.Errorf("RationalCriticalPoint(0) = %v, want 0", z)
+	}
+}
+
+func TestIterateDistance(t *testing.T) {
+	// The estimate is a lower bound on the true distance and, away from the
+	// escape radius, within a factor of about 4 of it.
+	tests := []struct {
+		name  string
+		z0, c complex128
+		wrtC  bool
+		dist  float64
+	}{
+		// For c = 0 the Julia set is the unit circle.
+		{"unit circle 1.5", 1.5, 0, false, 0.5},
+		{"unit circle 2i", 2i, 0, false, 1},
+		{"unit circle near boundary", 1.001, 0, false, 0.001},
+		// The Mandelbrot set meets the real axis at -2 and 0.25.
+		{"mandelbrot c=0.5", 0, 0.5, true, 0.25},
+		{"mandelbrot c=-3", 0, -3, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escaped, dist, _ := IterateDistance(tt.z0, tt.c, 2, 10000, DistanceEscapeRadius, tt.wrtC)
+			if !escaped {
+				t.Fatal("escaped = false, want true")
+			}
+			if dist < tt.dist/5 || dist > tt.dist {
+				t.Errorf("dist = %v, want in [%v, %v]", dist, tt.dist/5, tt.dist)
+			}
+		})
+	}
+}
+
+func TestIterateDistance_Interior(t *testing.T) {
+	escaped, dist, _ := IterateDistance(0.5, 0, 2, 256, DistanceEscapeRadius, false)
+	if escaped || dist != InteriorSentinel {
+		t.Errorf("IterateDistance = %v, %v; want false, %v", escaped, dist, InteriorSentinel)
+	}
+}
+
+func TestIterateDistance_Power(t *testing.T) {
+	// For z^3 with c = 0 the Julia set is still the unit circle.
+	for _, d := range []float64{3, 3.5} {
+		escaped, dist, _ := IterateDistance(2, 0, d, 256, DistanceEscapeRadius, false)
+		if !escaped || dist < 0.25 || dist > 1 {
+			t.Errorf("d=%v: IterateDistance = %v, %v; want true, in [0.25, 1]", d, escaped, dist)
+		}
+	}
+}
+
+func TestDistanceEstimate_Degenerate(t *testing.T) {
+	tests := []struct {
+		name string
+		mag2 float64
+		dz   complex128
+	}{
+		{"NaN magnitude", math.NaN(), 1},
+		{"Inf magnitude", math.Inf(1), 1},
+		{"inside unit circle", 0.25, 1},
+		{"Inf derivative", 4, complex(math.Inf(1), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DistanceEstimate(tt.mag2, tt.dz); got != 0 {
+				t.Errorf("DistanceEstimate(%v, %v) = %v, want 0", tt.mag2, tt.dz, got)
+			}
+		})
+	}
+}
+
+func TestParseChannel(t *testing.T) {
+	for _, ch := range []Channel{Smooth, Distance} {
+		got, ok := ParseChannel(ch.String())
+		if !ok || got != ch {
+			t.Errorf("ParseChannel(%q) = %v, %v; want %v, true", ch.String(), got, ok, ch)
+		}
+	}
+	if _, ok := ParseChannel("iterations"); ok {
+		t.Error("ParseChannel accepted an unknown name")
+	}
+}
+
+func TestPixelSpacing(t *testing.T) {
+	p := Params{MinX: -2, MaxX: 2, MinY: -1, MaxY: 1, Width: 400, Height: 100}
+	if got := p.PixelSpacing(); got != 0.02 {
+		t.Errorf("PixelSpacing() = %v, want 0.02", got)
+	}
+}
+
+func TestParamsKey_Interior(t *testing.T) {
+	nan1, nan2 := float32(math.NaN()), float32(math.NaN())
+	a := Params{Width: 1, Height: 1, Interior: &nan1}
+	b := Params{Width: 1, Height: 1, Interior: &nan2}
+	if a.Key() != b.Key() {
+		t.Errorf("NaN interior keys differ: %q vs %q", a.Key(), b.Key())
+	}
+
+	sentinel := float32(InteriorSentinel)
+	c := Params{Width: 1, Height: 1, Interior: &sentinel}
+	if c.Key() != (Params{Width: 1, Height: 1}).Key() {
+		t.Error("explicit sentinel interior has a different key from the default")
+	}
+}
+
+func TestUnityRoots(t *testing.T) {
+	for _, n := range []int{2, 3, 5} {
+		roots := UnityRoots(n)
+		if len(roots) != n || roots[0] != 1 {
+			t.Fatalf("UnityRoots(%d) = %v", n, roots)
+		}
+		for _, r := range roots {
+			if d := cmplx.Abs(cmplx.Pow(r, complex(float64(n), 0)) - 1); d > 1e-12 {
+				t.Errorf("UnityRoots(%d): %v^%d is %v from 1", n, r, n, d)
+			}
+		}
+	}
+}
+
+func TestPolynomialRoots(t *testing.T) {
+	tests := []struct {
+		name string
+		coef []complex128
+		want []complex128 // sorted by real part, then imaginary part
+	}{
+		{"z^2 - 1", []complex128{1, 0, -1}, []complex128{-1, 1}},
+		{"z^3 - 1", []complex128{1, 0, 0, -1}, []complex128{complex(-0.5, -math.Sqrt(3)/2), complex(-0.5, math.Sqrt(3)/2), 1}},
+		// (z - 1)(z - 2i)(z + 3) = z^3 + (2 - 2i)z^2 - (3 + 4i)z + 6i
+		{"complex coefficients", []complex128{1, 2 - 2i, -3 - 4i, 6i}, []complex128{-3, 2i, 1}},
+		{"leading zeros and scale", []complex128{0, 0, 2, 0, -8}, []complex128{-2, 2}},
+		{"repeated root", []complex128{1, -2, 1}, []complex128{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PolynomialRoots(tt.coef)
+			if len(got) != len(tt.want) {
+				t.Fatalf("PolynomialRoots = %v, want %v", got, tt.want)
+			}
+			// Repeated roots are only found to about the square root of the
+			// tolerance.
+			for i := range got {
+				if cmplx.Abs(got[i]-tt.want[i]) > 1e-6 {
+					t.Errorf("PolynomialRoots = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+
+	for _, coef := range [][]complex128{nil, {0, 0}, {5}, {1, cmplx.NaN()}} {
+		if got := PolynomialRoots(coef); got != nil {
+			t.Errorf("PolynomialRoots(%v) = %v, want nil", coef, got)
+		}
+	}
+}
+
+func TestIterateNewton(t *testing.T) {
+	roots := UnityRoots(3)
+	tests := []struct {
+		name     string
+		z0       complex128
+		wantRoot int
+		wantN    int
+	}{
+		{"starts on a root", roots[1], 1, 0},
+		{"real axis converges to 1", 2, 0, 5},
+		{"upper half plane", -1 + 1i, 1, 4},
+		{"lower half plane", -1 - 1i, 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, smooth, n := IterateNewton(tt.z0, roots, 100)
+			if root != tt.wantRoot || n != tt.wantN {
+				t.Fatalf("IterateNewton = (%d, %v, %d), want root %d after %d", root, smooth, n, tt.wantRoot, tt.wantN)
+			}
+			switch {
+			case root < 0:
+				if smooth != InteriorSentinel {
+					t.Errorf("smooth = %v, want %v", smooth, InteriorSentinel)
+				}
+			case smooth < math.Max(0, float64(n-1)) || smooth > float64(n):
+				t.Errorf("smooth = %v, want in [%d, %d]", smooth, max(n-1, 0), n)
+			}
+		})
+	}
+
+	if root, _, n := IterateNewton(0.5+0.5i, roots, 2); root != -1 || n != 2 {
+		t.Errorf("maxIter 2: IterateNewton = (%d, _, %d), want (-1, _, 2)", root, n)
+	}
+	// 0 is the critical point of z^2 - 1: f'(0) = 0 sends z to infinity.
+	if root, smooth, n := IterateNewton(0, []complex128{-1, 1}, 100); root != -1 || smooth != InteriorSentinel || n != 1 {
+		t.Errorf("critical point: IterateNewton = (%d, %v, %d), want (-1, %v, 1)", root, smooth, n, InteriorSentinel)
+	}
+}
+
+func TestIterateNewton_SmoothIsContinuous(t *testing.T) {
+	// Along the real axis the convergence count must not jump by more than
+	// a fraction of an iteration between close starting points.
+	roots := UnityRoots(3)
+	_, prev, _ := IterateNewton(1.5, roots, 100)
+	for x := 1.5; x < 3; x += 0.001 {
+		_, smooth, _ := IterateNewton(complex(x, 0), roots, 100)
+		if math.Abs(smooth-prev) > 0.5 {
+			t.Fatalf("smooth jumps from %v to %v at x=%v", prev, smooth, x)
+		}
+		prev = smooth
+	}
+}
+
+func TestNewtonValue(t *testing.T) {
+	tests := []struct {
+		root    int
+		smooth  float64
+		maxIter int
+	}{
+		{0, 0, 100},
+		{2, 37.5, 100},
+		{15, 9999.9999, 10000},
+		{3, math.Nextafter(256, 0), 256},
+	}
+	for _, tt := range tests {
+		v := float32(NewtonValue(tt.root, tt.smooth, tt.maxIter))
+		if got := int(math.Floor(float64(v))); got != tt.root {
+			t.Errorf("NewtonValue(%d, %v, %d) = %v, integer part %d", tt.root, tt.smooth, tt.maxIter, v, got)
+		}
+		if frac := float64(v) - float64(tt.root); math.Abs(frac*float64(tt.maxIter)-tt.smooth) > 1e-3*float64(tt.maxIter) {
+			t.Errorf("NewtonValue(%d, %v, %d) = %v, smooth %v", tt.root, tt.smooth, tt.maxIter, v, frac*float64(tt.maxIter))
+		}
+	}
+}
+
+func TestEvaluate_Newton(t *testing.T) {
+	p := Params{Formula: Newton, Fractal: Julia, Roots: UnityRoots(3), MaxIter: 100, C: 5}
+	escaped, v, n := Evaluate(-1+1i, p)
+	if !escaped || math.Floor(v) != 1 {
+		t.Errorf("Evaluate(-1+1i) = (%v, %v, %d), want converged to root 1", escaped, v, n)
+	}
+	p.Roots = []complex128{-1, 1}
+	escaped, v, _ = Evaluate(0, p)
+	if escaped || v != InteriorSentinel {
+		t.Errorf("Evaluate(0) = (%v, %v), want (false, %v)", escaped, v, InteriorSentinel)
+	}
+}
@@ -0,0 +1,164 @@
+package julia
+
+import (
+	"math"
+	"math/cmplx"
+	"slices"
+)
+
+// NewtonTolerance is the distance from a root at which Newton's method is
+// considered to have converged.
+const NewtonTolerance = 1e-6
+
+// Limits of PolynomialRoots.
+const (
+	rootsMaxIter   = 500
+	rootsTolerance = 1e-14
+)
+
+// UnityRoots returns the n-th roots of unity, the roots of z^n - 1,
+// starting from 1 and going anticlockwise.
+func UnityRoots(n int) []complex128 {
+	roots := make([]complex128, n)
+	for k := range roots {
+		roots[k] = cmplx.Rect(1, 2*math.Pi*float64(k)/float64(n))
+	}
+	return roots
+}
+
+// PolynomialRoots returns the roots of the polynomial with the given
+// coefficients, highest degree first, found by the Durand-Kerner method.
+// Leading zero coefficients are ignored. Roots are ordered by real part,
+// then imaginary part, so that their order does not depend on the method.
+// It returns nil for polynomials of degree 0 and for coefficients that are
+// not finite.
+func PolynomialRoots(coef []complex128) []complex128 {
+	for len(coef) > 0 && coef[0] == 0 {
+		coef = coef[1:]
+	}
+	if len(coef) < 2 {
+		return nil
+	}
+	for _, a := range coef {
+		if cmplx.IsNaN(a) || cmplx.IsInf(a) {
+			return nil
+		}
+	}
+	// Make the polynomial monic.
+	monic := make([]complex128, len(coef))
+	for i, a := range coef {
+		monic[i] = a / coef[0]
+	}
+	eval := func(z complex128) complex128 {
+		var v complex128
+		for _, a := range monic {
+			v = v*z + a
+		}
+		return v
+	}
+
+	// Start from points on a circle enclosing every root, in a direction
+	// that is not symmetric with respect to the real axis.
+	bound := 0.0
+	for _, a := range monic[1:] {
+		bound = math.Max(bound, cmplx.Abs(a))
+	}
+	bound++
+	deg := len(monic) - 1
+	roots := make([]complex128, deg)
+	for k := range roots {
+		roots[k] = cmplx.Rect(bound, 2*math.Pi*float64(k)/float64(deg)+0.4)
+	}
+
+	for range rootsMaxIter {
+		moved := 0.0
+		for k, z := range roots {
+			den := complex(1, 0)
+			for j, w := range roots {
+				if j != k {
+					den *= z - w
+				}
+			}
+			if den == 0 {
+				den = complex(rootsTolerance, 0)
+			}
+			step := eval(z) / den
+			roots[k] = z - step
+			moved = math.Max(moved, cmplx.Abs(step)/math.Max(1, cmplx.Abs(z)))
+		}
+		if moved < rootsTolerance {
+			break
+		}
+	}
+
+	slices.SortFunc(roots, func(a, b complex128) int {
+		if c := cmpFloat(real(a), real(b)); c != 0 {
+			return c
+		}
+		return cmpFloat(imag(a), imag(b))
+	})
+	return roots
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// IterateNewton applies Newton's method, z = z - f(z)/f'(z), from z0 to
+// the polynomial f with the given roots, until z is within NewtonTolerance
+// of one of them. f'/f is the sum of 1/(z - r) over the roots, so repeated
+// roots count with their multiplicity.
+//
+// For a point that converges it returns the index of the root, a smooth
+// convergence count in [i-1, i] (clamped at 0) for convergence at
+// iteration i, and i. For a point that does not converge within maxIter
+// iterations, or lands on a critical point of f, it returns -1,
+// InteriorSentinel and the number of iterations performed.
+func IterateNewton(z0 complex128, roots []complex128, maxIter int) (root int, smooth float64, n int) {
+	z := z0
+	for i := 0; i < maxIter; i++ {
+		for k, r := range roots {
+			if d := cmplx.Abs(z - r); d < NewtonTolerance {
+				return k, newtonSmooth(i, d), i
+			}
+		}
+
+		var s complex128 // f'(z)/f(z)
+		for _, r := range roots {
+			s += 1 / (z - r)
+		}
+		z -= 1 / s
+		if cmplx.IsNaN(z) || cmplx.IsInf(z) {
+			return -1, InteriorSentinel, i + 1
+		}
+	}
+	return -1, InteriorSentinel, maxIter
+}
+
+// newtonSmooth interpolates the iteration at which the distance to the
+// root crossed NewtonTolerance, assuming the distance squares each step as
+// it does near a simple root. d is the distance at iteration i.
+func newtonSmooth(i int, d float64) float64 {
+	s := float64(i) - math.Log2(math.Log(d)/math.Log(NewtonTolerance))
+	if math.IsNaN(s) {
+		s = float64(i)
+	}
+	return math.Max(0, math.Max(float64(i-1), math.Min(s, float64(i))))
+}
+
+// NewtonValue packs a root index and a smooth convergence count below
+// maxIter into one value, root + smooth/maxIter, whose float32 rounding
+// keeps the root index as its integer part.
+func NewtonValue(root int, smooth float64, maxIter int) float64 {
+	v := float64(root) + smooth/float64(maxIter)
+	if next := float32(root + 1); float32(v) >= next {
+		v = float64(math.Nextafter32(next, 0))
+	}
+	return v
+}
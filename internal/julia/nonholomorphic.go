@@ -0,0 +1,50 @@
+package julia
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// IterateBurningShip is IteratePower for the Burning Ship map
+// z = (|Re z| + i|Im z|)^d + c, which folds z into the first quadrant
+// before each power. The fold keeps |z|, so the escape test and smooth
+// count are those of z^d + c.
+func IterateBurningShip(z0, c complex128, d float64, maxIter int, escapeRadius float64) (escaped bool, smooth float64, n int) {
+	return iterateFolded(z0, c, d, maxIter, escapeRadius, func(z complex128) complex128 {
+		return complex(math.Abs(real(z)), math.Abs(imag(z)))
+	})
+}
+
+// IterateTricorn is IteratePower for the Tricorn map z = conj(z)^d + c.
+// Conjugation keeps |z|, so the escape test and smooth count are those of
+// z^d + c.
+func IterateTricorn(z0, c complex128, d float64, maxIter int, escapeRadius float64) (escaped bool, smooth float64, n int) {
+	return iterateFolded(z0, c, d, maxIter, escapeRadius, cmplx.Conj)
+}
+
+// iterateFolded iterates z = fold(z)^d + c, where fold must keep |z|.
+func iterateFolded(z0, c complex128, d float64, maxIter int, escapeRadius float64, fold func(complex128) complex128) (escaped bool, smooth float64, n int) {
+	z := z0
+	er2 := escapeRadius * escapeRadius
+	k := int(d)
+	integer := float64(k) == d
+
+	for i := 0; i < maxIter; i++ {
+		zr := real(z)
+		zi := imag(z)
+		mag2 := zr*zr + zi*zi
+
+		if !(mag2 <= er2) {
+			return true, SmoothCount(i, mag2, d), i
+		}
+
+		z = fold(z)
+		if integer {
+			z = powInt(z, k) + c
+		} else {
+			z = cmplx.Pow(z, complex(d, 0)) + c
+		}
+	}
+
+	return false, InteriorSentinel, maxIter
+}
@@ -0,0 +1,35 @@
+package julia
+
+import "math/cmplx"
+
+// IteratePhoenix is IteratePower for the Phoenix map
+// z_{n+1} = z_n^d + c + p·z_{n-1}, which adds p times the previous iterate,
+// starting from z_{-1} = 0. For large |z| the z^d term dominates, so the
+// smooth count uses degree d as for z^d + c; with |p| well above 1 the
+// escape radius should be raised to match.
+func IteratePhoenix(z0, c, p complex128, d float64, maxIter int, escapeRadius float64) (escaped bool, smooth float64, n int) {
+	z, prev := z0, complex128(0)
+	er2 := escapeRadius * escapeRadius
+	k := int(d)
+	integer := float64(k) == d
+
+	for i := 0; i < maxIter; i++ {
+		zr := real(z)
+		zi := imag(z)
+		mag2 := zr*zr + zi*zi
+
+		if !(mag2 <= er2) {
+			return true, SmoothCount(i, mag2, d), i
+		}
+
+		var next complex128
+		if integer {
+			next = powInt(z, k) + c + p*prev
+		} else {
+			next = cmplx.Pow(z, complex(d, 0)) + c + p*prev
+		}
+		z, prev = next, z
+	}
+
+	return false, InteriorSentinel, maxIter
+}
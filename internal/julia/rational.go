@@ -0,0 +1,54 @@
+package julia
+
+import "math/cmplx"
+
+// IterateRational is IteratePower for the rational map
+// z = z^n + c + λ/z^m, which with c = 0 is a McMullen map and otherwise a
+// singular perturbation of z^n + c. n and m must be >= 1.
+//
+// With λ != 0, 0 is a pole: it maps to infinity, and points near it to
+// points near infinity, so orbits can escape through 0 as well as by
+// growing. An orbit that lands on 0, or on a point whose z^m underflows,
+// counts as escaped on the iteration where that happens, even if it is
+// the last, with a smooth count of 0 as for an overflowed orbit of
+// Iterate. Near infinity the map behaves like z^n, so the smooth count
+// uses degree n; escapes are final for escape radii of at least
+// max(2, |c| + |λ|).
+func IterateRational(z0, c, lambda complex128, n, m, maxIter int, escapeRadius float64) (escaped bool, smooth float64, iters int) {
+	z := z0
+	er2 := escapeRadius * escapeRadius
+
+	for i := 0; i < maxIter; i++ {
+		zr := real(z)
+		zi := imag(z)
+		mag2 := zr*zr + zi*zi
+
+		if !(mag2 <= er2) {
+			return true, SmoothCount(i, mag2, float64(n)), i
+		}
+
+		next := powInt(z, n) + c
+		if lambda != 0 {
+			zm := powInt(z, m)
+			if zm == 0 {
+				return true, 0, i + 1
+			}
+			next += lambda / zm
+		}
+		z = next
+	}
+
+	return false, InteriorSentinel, maxIter
+}
+
+// RationalCriticalPoint returns a free critical point of z^n + c + λ/z^m,
+// the principal root of z^(n+m) = m·λ/n. For c = 0 the map commutes with
+// rotation by the (n+m)-th roots of unity up to a rotation of its value,
+// so every free critical point has an orbit of the same fate; otherwise
+// the others may differ. For λ = 0 it is 0, the critical point of z^n + c.
+func RationalCriticalPoint(lambda complex128, n, m int) complex128 {
+	if lambda == 0 {
+		return 0
+	}
+	return cmplx.Pow(complex(float64(m)/float64(n), 0)*lambda, complex(1/float64(n+m), 0))
+}
@@ -0,0 +1,75 @@
+package julia
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// TranscendentalEscapeRadius is the default bailout for the Exp, Sin and
+// Cos formulas. It bounds Re z or |Im z| rather than |z|: past it the next
+// iterate has magnitude near e^50, beyond any bounded orbit.
+const TranscendentalEscapeRadius = 50.0
+
+// IterateExp iterates z = λ·exp(z). Escaping orbits of the exponential
+// family run off to the right, and |λ·exp(z)| = |λ|·e^Re(z), so a point
+// escapes once Re z > escapeRadius. Orbits that run off to the left are
+// mapped back near 0 and do not escape.
+func IterateExp(z0, lambda complex128, maxIter int, escapeRadius float64) (escaped bool, smooth float64, n int) {
+	return iterateTranscendental(z0, lambda, maxIter, escapeRadius, cmplx.Exp, realPart)
+}
+
+// IterateSin iterates z = λ·sin(z). |sin z| grows like e^|Im z|/2 and is
+// bounded along the real axis, so a point escapes once
+// |Im z| > escapeRadius.
+func IterateSin(z0, lambda complex128, maxIter int, escapeRadius float64) (escaped bool, smooth float64, n int) {
+	return iterateTranscendental(z0, lambda, maxIter, escapeRadius, cmplx.Sin, absImag)
+}
+
+// IterateCos iterates z = λ·cos(z), which escapes like IterateSin.
+func IterateCos(z0, lambda complex128, maxIter int, escapeRadius float64) (escaped bool, smooth float64, n int) {
+	return iterateTranscendental(z0, lambda, maxIter, escapeRadius, cmplx.Cos, absImag)
+}
+
+func realPart(z complex128) float64 {
+	return real(z)
+}
+
+func absImag(z complex128) float64 {
+	return math.Abs(imag(z))
+}
+
+// iterateTranscendental iterates z = λ·f(z) until size(z) > escapeRadius.
+// The test is done before each step, so f only sees arguments whose
+// image is bounded by about e^escapeRadius; overflow to Inf or NaN from
+// larger radii counts as escaping on the next test.
+func iterateTranscendental(z0, lambda complex128, maxIter int, escapeRadius float64, f func(complex128) complex128, size func(complex128) float64) (escaped bool, smooth float64, n int) {
+	z := z0
+	prev := math.Inf(-1)
+
+	for i := 0; i < maxIter; i++ {
+		s := size(z)
+		if !(s <= escapeRadius) {
+			return true, transcendentalSmooth(i, prev, s, escapeRadius), i
+		}
+		prev = s
+		z = lambda * f(z)
+	}
+
+	return false, InteriorSentinel, maxIter
+}
+
+// transcendentalSmooth returns a smooth count in [i, i+1] for a point
+// whose escape test value crossed r between prev, at iteration i-1, and
+// s, at iteration i. These maps grow too fast for the log-log correction
+// of SmoothCount, so the fraction is interpolated linearly between the
+// two values, which is continuous as either of them approaches r. Points
+// escaping at once count 1 and overflowed values count i, their limits.
+func transcendentalSmooth(i int, prev, s, r float64) float64 {
+	if i == 0 {
+		return 1
+	}
+	if math.IsNaN(s) || math.IsInf(s, 0) {
+		return float64(i)
+	}
+	return float64(i) + 1 - (s-r)/(s-prev)
+}
@@ -0,0 +1,271 @@
+// Package metrics provides counters, gauges and histograms and serves them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DurationBuckets are histogram bucket upper bounds, in seconds, spanning
+// a small tile to a large poster.
+var DurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Default is the registry served by Handler.
+var Default = NewRegistry()
+
+// Counter is a value that only goes up.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Add adds n to c.
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Inc adds 1 to c.
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Value returns the current value of c.
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	v atomic.Int64
+}
+
+// Inc adds 1 to g.
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+// Dec subtracts 1 from g.
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+// Value returns the current value of g.
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+// Histogram counts observations in buckets with fixed upper bounds.
+type Histogram struct {
+	upper  []float64       // sorted bucket upper bounds
+	counts []atomic.Uint64 // per bucket, not cumulative; the last is +Inf
+	count  atomic.Uint64
+	sum    atomic.Uint64 // float64 bits
+}
+
+// Observe records v.
+func (h *Histogram) Observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.upper, v)].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// CounterVec is a family of counters told apart by the value of one label.
+type CounterVec struct {
+	label    string
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for the given label value, creating it on first
+// use.
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.counters[value]
+	if !ok {
+		c = new(Counter)
+		v.counters[value] = c
+	}
+	return c
+}
+
+// metric is a registered metric of any kind.
+type metric struct {
+	name, help, typ string
+	write           func(w io.Writer, name string)
+}
+
+// Registry holds a set of uniquely named metrics. It is safe for
+// concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register adds m, panicking if its name is taken: metrics are registered
+// at package initialisation, where a clash is a programming error.
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[m.name]; ok {
+		panic("metrics: duplicate metric " + m.name)
+	}
+	r.metrics[m.name] = m
+}
+
+// NewCounter registers and returns a counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := new(Counter)
+	r.register(metric{name, help, "counter", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, c.Value())
+	}})
+	return c
+}
+
+// NewGauge registers and returns a gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := new(Gauge)
+	r.register(metric{name, help, "gauge", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, g.Value())
+	}})
+	return g
+}
+
+// NewHistogram registers and returns a histogram with the given bucket
+// upper bounds, which must be sorted in increasing order.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		upper:  slices.Clone(buckets),
+		counts: make([]atomic.Uint64, len(buckets)+1),
+	}
+	r.register(metric{name, help, "histogram", func(w io.Writer, name string) {
+		var cumulative uint64
+		for i := range h.counts {
+			cumulative += h.counts[i].Load()
+			le := "+Inf"
+			if i < len(h.upper) {
+				le = formatFloat(h.upper[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, le, cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(math.Float64frombits(h.sum.Load())))
+		fmt.Fprintf(w, "%s_count %d\n", name, h.count.Load())
+	}})
+	return h
+}
+
+// NewCounterVec registers and returns a family of counters with one label.
+// Label values appear in the output once they have been used.
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label, counters: make(map[string]*Counter)}
+	r.register(metric{name, help, "counter", func(w io.Writer, name string) {
+		v.mu.Lock()
+		values := make([]string, 0, len(v.counters))
+		for value := range v.counters {
+			values = append(values, value)
+		}
+		v.mu.Unlock()
+		sort.Strings(values)
+		for _, value := range values {
+			fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, v.label, escapeLabel(value), v.With(value).Value())
+		}
+	}})
+	return v
+}
+
+// Write writes every metric in r, sorted by name, in the text exposition
+// format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	ms := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		ms = append(ms, m)
+	}
+	r.mu.Unlock()
+	slices.SortFunc(ms, func(a, b metric) int { return strings.Compare(a.name, b.name) })
+
+	// bufio.Writer keeps the first error and reports it from Flush.
+	bw := bufio.NewWriter(w)
+	for _, m := range ms {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, strings.ReplaceAll(m.help, "\n", `\n`))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.typ)
+		m.write(bw, m.name)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP writes r in the text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.Write(w)
+}
+
+// NewCounter registers a counter with Default.
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewGauge registers a gauge with Default.
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewHistogram registers a histogram with Default.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.NewHistogram(name, help, buckets)
+}
+
+// NewCounterVec registers a family of counters with Default.
+func NewCounterVec(name, help, label string) *CounterVec {
+	return Default.NewCounterVec(name, help, label)
+}
+
+// Handler serves the metrics of Default.
+func Handler() http.Handler {
+	return Default
+}
+
+// formatFloat formats f as Prometheus expects, including +Inf and NaN.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value for use between double quotes.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "A counter.")
+	g := r.NewGauge("test_in_flight", "A gauge.")
+	h := r.NewHistogram("test_seconds", "A histogram.", []float64{0.5, 1})
+	v := r.NewCounterVec("test_errors_total", "A counter family.", "kind")
+
+	c.Add(3)
+	c.Inc()
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	h.Observe(0.25)
+	h.Observe(1) // bucket bounds are inclusive
+	h.Observe(4)
+	v.With("missing").Inc()
+	v.With(`a"b`).Add(2)
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	want := `# HELP test_errors_total A counter family.
+# TYPE test_errors_total counter
+test_errors_total{kind="a\"b"} 2
+test_errors_total{kind="missing"} 1
+# HELP test_in_flight A gauge.
+# TYPE test_in_flight gauge
+test_in_flight 1
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.5"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 5.25
+test_seconds_count 3
+# HELP test_total A counter.
+# TYPE test_total counter
+test_total 4
+`
+	if got := b.String(); got != want {
+		t.Errorf("Write output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistry_DuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("dup", "First.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate name did not panic")
+		}
+	}()
+	r.NewGauge("dup", "Second.")
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("served_total", "Served.").Inc()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Result().Header.Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	if !strings.Contains(w.Body.String(), "served_total 1\n") {
+		t.Errorf("body = %q, want served_total 1", w.Body.String())
+	}
+}
@@ -0,0 +1,155 @@
+// Package pngstream writes 8-bit RGB PNG images row by row, so images far
+// larger than memory can be encoded as they are produced. image/png needs
+// the whole image up front.
+package pngstream
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// maxChunkSize is the largest IDAT chunk written.
+	maxChunkSize = 1 << 16
+
+	// maxDimension is the PNG limit on width and height.
+	maxDimension = 1<<31 - 1
+
+	bytesPerPixel = 3
+	colorTypeRGB  = 2
+	filterSub     = 1
+)
+
+var signature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// Writer encodes one image. Rows are written top to bottom with WriteRows,
+// and Close completes the file once every row has been written.
+type Writer struct {
+	w      io.Writer
+	width  int
+	height int
+	rows   int
+	idat   *bufio.Writer
+	zw     *zlib.Writer
+	line   []byte // filter byte plus one filtered row
+	err    error
+}
+
+// NewWriter writes the PNG header for a width x height image to w.
+func NewWriter(w io.Writer, width, height int) (*Writer, error) {
+	if width <= 0 || height <= 0 || width > maxDimension || height > maxDimension {
+		return nil, fmt.Errorf("pngstream: invalid dimensions %dx%d", width, height)
+	}
+	if _, err := w.Write(signature); err != nil {
+		return nil, err
+	}
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(height))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = colorTypeRGB
+	if err := writeChunk(w, "IHDR", ihdr[:]); err != nil {
+		return nil, err
+	}
+
+	pw := &Writer{
+		w:      w,
+		width:  width,
+		height: height,
+		line:   make([]byte, 1+width*bytesPerPixel),
+	}
+	pw.idat = bufio.NewWriterSize(chunkWriter{w}, maxChunkSize)
+	pw.zw = zlib.NewWriter(pw.idat)
+	return pw, nil
+}
+
+// WriteRows encodes whole rows of RGB pixels, 3 bytes per pixel.
+// len(pix) must be a multiple of the row size.
+func (pw *Writer) WriteRows(pix []byte) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	stride := pw.width * bytesPerPixel
+	if len(pix)%stride != 0 {
+		return fmt.Errorf("pngstream: %d bytes is not a whole number of %d-byte rows", len(pix), stride)
+	}
+	if pw.rows+len(pix)/stride > pw.height {
+		return errors.New("pngstream: more rows than the image height")
+	}
+
+	for ; len(pix) > 0; pix = pix[stride:] {
+		// The Sub filter stores each byte as the difference from the same
+		// channel one pixel to the left, which suits smooth gradients.
+		row := pix[:stride]
+		pw.line[0] = filterSub
+		copy(pw.line[1:1+bytesPerPixel], row)
+		for i := bytesPerPixel; i < stride; i++ {
+			pw.line[1+i] = row[i] - row[i-bytesPerPixel]
+		}
+		if _, err := pw.zw.Write(pw.line); err != nil {
+			pw.err = err
+			return err
+		}
+		pw.rows++
+	}
+	return nil
+}
+
+// Close flushes the image data and writes the end of the file. It fails if
+// fewer rows than the image height were written.
+func (pw *Writer) Close() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if pw.rows != pw.height {
+		return fmt.Errorf("pngstream: wrote %d of %d rows", pw.rows, pw.height)
+	}
+	if err := pw.zw.Close(); err != nil {
+		return err
+	}
+	if err := pw.idat.Flush(); err != nil {
+		return err
+	}
+	return writeChunk(pw.w, "IEND", nil)
+}
+
+// chunkWriter writes its input as IDAT chunks of at most maxChunkSize bytes.
+type chunkWriter struct {
+	w io.Writer
+}
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := min(len(p)-written, maxChunkSize)
+		if err := writeChunk(c.w, "IDAT", p[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// writeChunk writes a PNG chunk: length, type, data and CRC.
+func writeChunk(w io.Writer, typ string, data []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(len(data)))
+	copy(hdr[4:8], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:8])
+	crc.Write(data)
+	var tail [4]byte
+	binary.BigEndian.PutUint32(tail[:], crc.Sum32())
+
+	for _, b := range [][]byte{hdr[:], data, tail[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
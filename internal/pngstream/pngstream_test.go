@@ -0,0 +1,116 @@
+package pngstream
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+// gradient returns an RGB image of the given size whose channels vary
+// with x and y.
+func gradient(width, height int) []byte {
+	pix := make([]byte, width*height*bytesPerPixel)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			off := (y*width + x) * bytesPerPixel
+			pix[off] = byte(x)
+			pix[off+1] = byte(y)
+			pix[off+2] = byte(x*y + 7)
+		}
+	}
+	return pix
+}
+
+func TestWriter_DecodesWithImagePNG(t *testing.T) {
+	const width, height = 300, 70
+	pix := gradient(width, height)
+
+	var b bytes.Buffer
+	w, err := NewWriter(&b, width, height)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	// Uneven batches of rows, as strips of a render would arrive.
+	stride := width * bytesPerPixel
+	for _, rows := range []int{1, 16, 50, 3} {
+		if err := w.WriteRows(pix[:rows*stride]); err != nil {
+			t.Fatalf("WriteRows: %v", err)
+		}
+		pix = pix[rows*stride:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	img, err := png.Decode(&b)
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != width || bounds.Dy() != height {
+		t.Fatalf("bounds = %v, want %dx%d", bounds, width, height)
+	}
+	want := gradient(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			off := (y*width + x) * bytesPerPixel
+			got := [4]uint8{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8), uint8(a >> 8)}
+			if got != [4]uint8{want[off], want[off+1], want[off+2], 255} {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want[off:off+3])
+			}
+		}
+	}
+}
+
+func TestWriter_LargeImageUsesSeveralChunks(t *testing.T) {
+	const width, height = 512, 512
+	var b bytes.Buffer
+	w, err := NewWriter(&b, width, height)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	// Noise compresses poorly, so the data spans several IDAT chunks.
+	pix := make([]byte, width*height*bytesPerPixel)
+	x := uint32(1)
+	for i := range pix {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		pix[i] = byte(x)
+	}
+	if err := w.WriteRows(pix); err != nil {
+		t.Fatalf("WriteRows: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := bytes.Count(b.Bytes(), []byte("IDAT")); n < 2 {
+		t.Errorf("found %d IDAT chunks, want several", n)
+	}
+	if _, err := png.Decode(&b); err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+}
+
+func TestWriter_Errors(t *testing.T) {
+	if _, err := NewWriter(&bytes.Buffer{}, 0, 10); err == nil {
+		t.Error("NewWriter accepted a zero width")
+	}
+
+	w, err := NewWriter(&bytes.Buffer{}, 2, 2)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := w.WriteRows(make([]byte, 5)); err == nil {
+		t.Error("WriteRows accepted a partial row")
+	}
+	if err := w.WriteRows(make([]byte, 18)); err == nil {
+		t.Error("WriteRows accepted more rows than the height")
+	}
+	if err := w.WriteRows(make([]byte, 6)); err != nil {
+		t.Fatalf("WriteRows: %v", err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close succeeded with rows missing")
+	}
+}
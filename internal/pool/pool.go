@@ -0,0 +1,173 @@
+// Package pool provides a bounded worker pool shared by concurrent requests.
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned by Do when the pool already holds its maximum
+// number of jobs.
+var ErrQueueFull = errors.New("pool: queue full")
+
+// ErrClosed is returned by Do after Close has been called.
+var ErrClosed = errors.New("pool: closed")
+
+// Pool runs the tasks of submitted jobs on a fixed set of worker goroutines.
+// Jobs are served round-robin one task at a time, so a large job cannot
+// starve the small jobs queued behind it.
+type Pool struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []*job // jobs with undispatched tasks
+	next     int    // index into queue of the job served next
+	admitted int    // jobs accepted by Do and not yet finished
+	maxJobs  int
+	workers  int
+	closed   bool
+}
+
+type job struct {
+	ctx     context.Context
+	fn      func(i int)
+	n       int
+	next    int // next task index to dispatch
+	pending int // tasks not yet completed or dropped
+	done    chan struct{}
+}
+
+// New starts a pool with the given number of workers that admits at most
+// queueDepth jobs at a time. Values below 1 are treated as 1.
+func New(workers, queueDepth int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueDepth < 1 {
+		queueDepth = 1
+	}
+	p := &Pool{maxJobs: queueDepth, workers: workers}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Workers returns the number of worker goroutines.
+func (p *Pool) Workers() int {
+	return p.workers
+}
+
+// Do runs fn(0) through fn(n-1) on the pool's workers and waits for them to
+// finish. It returns ErrQueueFull without running anything if the pool is at
+// capacity. If ctx is cancelled, tasks that have not started are dropped and
+// Do returns ctx.Err() once the tasks already running have returned.
+func (p *Pool) Do(ctx context.Context, n int, fn func(i int)) error {
+	if n <= 0 {
+		return ctx.Err()
+	}
+
+	j := &job{ctx: ctx, fn: fn, n: n, pending: n, done: make(chan struct{})}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	if p.admitted >= p.maxJobs {
+		p.mu.Unlock()
+		return ErrQueueFull
+	}
+	p.admitted++
+	p.queue = append(p.queue, j)
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.dropLocked(j)
+		p.mu.Unlock()
+		<-j.done
+	}
+	return ctx.Err()
+}
+
+// Close stops the workers once the queued jobs have been dispatched.
+// Subsequent calls to Do return ErrClosed.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+func (p *Pool) work() {
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			return
+		}
+
+		if p.next >= len(p.queue) {
+			p.next = 0
+		}
+		j := p.queue[p.next]
+		i := j.next
+		j.next++
+		if j.next == j.n {
+			p.removeLocked(p.next)
+		} else {
+			p.next++
+		}
+		p.mu.Unlock()
+
+		if j.ctx.Err() == nil {
+			j.fn(i)
+		}
+
+		p.mu.Lock()
+		j.pending--
+		p.finishLocked(j)
+		p.mu.Unlock()
+	}
+}
+
+// dropLocked discards the undispatched tasks of j.
+func (p *Pool) dropLocked(j *job) {
+	for idx, q := range p.queue {
+		if q == j {
+			p.removeLocked(idx)
+			break
+		}
+	}
+	j.pending -= j.n - j.next
+	j.next = j.n
+	p.finishLocked(j)
+}
+
+// removeLocked removes the job at idx from the round-robin queue.
+func (p *Pool) removeLocked(idx int) {
+	p.queue = append(p.queue[:idx], p.queue[idx+1:]...)
+	if p.next > idx {
+		p.next--
+	}
+}
+
+// finishLocked releases j once no tasks remain outstanding.
+func (p *Pool) finishLocked(j *job) {
+	if j.pending == 0 && j.next == j.n {
+		select {
+		case <-j.done:
+		default:
+			close(j.done)
+			p.admitted--
+		}
+	}
+}
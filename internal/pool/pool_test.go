@@ -0,0 +1,173 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo_RunsEveryTask(t *testing.T) {
+	p := New(4, 8)
+	defer p.Close()
+
+	var hits [100]atomic.Int32
+	if err := p.Do(context.Background(), len(hits), func(i int) { hits[i].Add(1) }); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	for i := range hits {
+		if n := hits[i].Load(); n != 1 {
+			t.Errorf("task %d ran %d times, want 1", i, n)
+		}
+	}
+}
+
+func TestDo_ZeroTasks(t *testing.T) {
+	p := New(1, 1)
+	defer p.Close()
+
+	if err := p.Do(context.Background(), 0, func(int) { t.Error("fn called for empty job") }); err != nil {
+		t.Errorf("Do: %v", err)
+	}
+}
+
+func TestDo_RoundRobin(t *testing.T) {
+	p := New(1, 4)
+	defer p.Close()
+
+	var mu sync.Mutex
+	var order []string
+	record := func(s string) {
+		mu.Lock()
+		order = append(order, s)
+		mu.Unlock()
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.Do(context.Background(), 3, func(i int) {
+			if i == 0 {
+				close(started)
+				<-release
+			}
+			record("a")
+		})
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		p.Do(context.Background(), 3, func(int) { record("b") })
+	}()
+	// Wait until the second job is queued before letting the worker continue.
+	for {
+		p.mu.Lock()
+		n := len(p.queue)
+		p.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	want := []string{"a", "b", "a", "b", "a", "b"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestDo_QueueFull(t *testing.T) {
+	p := New(1, 1)
+	defer p.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go p.Do(context.Background(), 1, func(int) {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	if err := p.Do(context.Background(), 1, func(int) {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("err = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestDo_AdmitsAgainAfterJobFinishes(t *testing.T) {
+	p := New(2, 1)
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := p.Do(context.Background(), 10, func(int) {}); err != nil {
+			t.Fatalf("Do #%d: %v", i, err)
+		}
+	}
+}
+
+func TestDo_CancelDropsPendingTasks(t *testing.T) {
+	p := New(1, 2)
+	defer p.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran atomic.Int32
+	err := p.Do(ctx, 1000, func(i int) {
+		ran.Add(1)
+		if i == 0 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if n := ran.Load(); n >= 1000 {
+		t.Errorf("ran %d tasks after cancellation, want fewer than 1000", n)
+	}
+
+	// The cancelled job must no longer count against the queue depth.
+	if err := p.Do(context.Background(), 1, func(int) {}); err != nil {
+		t.Errorf("Do after cancel: %v", err)
+	}
+	if err := p.Do(context.Background(), 1, func(int) {}); err != nil {
+		t.Errorf("second Do after cancel: %v", err)
+	}
+}
+
+func TestDo_CancelWhileQueued(t *testing.T) {
+	p := New(1, 2)
+	defer p.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go p.Do(context.Background(), 1, func(int) {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := p.Do(ctx, 5, func(int) { t.Error("task of cancelled job ran") })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestDo_AfterClose(t *testing.T) {
+	p := New(1, 1)
+	p.Close()
+
+	if err := p.Do(context.Background(), 1, func(int) {}); !errors.Is(err, ErrClosed) {
+		t.Errorf("err = %v, want ErrClosed", err)
+	}
+}
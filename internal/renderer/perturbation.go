@@ -0,0 +1,199 @@
+package renderer
+
+import (
+	"math/big"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+)
+
+// MinPerturbationSpacing is the smallest pixel spacing whose offsets stay
+// well clear of float64 underflow. Deeper renders fall back to math/big,
+// which has no distance channel.
+const MinPerturbationSpacing = 1e-290
+
+// BelowPerturbationLimit reports whether the pixels of the exact viewport
+// of p, measured at precision prec, are narrower or shorter than
+// MinPerturbationSpacing, so that a render of p at that precision iterates
+// every pixel in math/big.
+func BelowPerturbationLimit(p julia.Params, prec uint) bool {
+	spanX, spanY := exactSpans(p, prec)
+	return belowPerturbationLimit(p, spanX, spanY)
+}
+
+// exactSpans returns the width and height of the exact viewport of p at
+// precision prec.
+func exactSpans(p julia.Params, prec uint) (spanX, spanY *big.Float) {
+	spanX = new(big.Float).SetPrec(prec).Sub(p.Exact.MaxX, p.Exact.MinX)
+	spanY = new(big.Float).SetPrec(prec).Sub(p.Exact.MaxY, p.Exact.MinY)
+	return spanX, spanY
+}
+
+// belowPerturbationLimit is BelowPerturbationLimit for spans already
+// computed by exactSpans.
+func belowPerturbationLimit(p julia.Params, spanX, spanY *big.Float) bool {
+	sx, _ := spanX.Float64()
+	sy, _ := spanY.Float64()
+	return sx/float64(p.Width) < MinPerturbationSpacing || sy/float64(p.Height) < MinPerturbationSpacing
+}
+
+// perturbation renders a quadratic high-precision viewport from a single
+// reference orbit computed with math/big at the viewport centre. Each pixel
+// then only iterates its offset δ from that orbit in float64:
+//
+//	δ' = 2·Z·δ + δ² + δc
+//
+// where δc is the pixel's offset in c (zero for Julia sets, whose offset
+// is in z0 instead). Precision loss ("glitches") appears when the pixel's
+// orbit passes closer to the reference start than δ itself, or when the
+// reference orbit runs out; both are repaired by re-referencing the pixel
+// to the start of the orbit with δ = z - Z₀ ("rebasing"), so a single
+// reference serves the whole image. z - Z₀ is formed from the exact
+// differences Zₘ - Z₀ of the orbit, since subtracting rounded values would
+// lose δ entirely.
+//
+// For the Distance channel each pixel also tracks the derivative of its
+// orbit, dz' = 2·z·dz (+1 for the Mandelbrot set), from the full value z;
+// the derivative needs no more than float64 precision.
+type perturbation struct {
+	p              julia.Params
+	orbit          []complex128 // Zₘ
+	fromStart      []complex128 // Zₘ - Z₀, computed before rounding
+	spanX, spanY   float64
+	er2            float64
+	mandelbrotMode bool
+	distance       bool
+}
+
+// newPerturbation computes the reference orbit for p, or returns nil if p
+// is outside what perturbation handles.
+func newPerturbation(p julia.Params) *perturbation {
+	if p.Prec == 0 || p.Exact == nil || p.Formula != julia.Polynomial || p.Degree() != 2 {
+		return nil
+	}
+
+	prec := p.Prec
+	spanX, spanY := exactSpans(p, prec)
+	if belowPerturbationLimit(p, spanX, spanY) {
+		return nil
+	}
+	sx, _ := spanX.Float64()
+	sy, _ := spanY.Float64()
+
+	half := big.NewFloat(0.5)
+	centerRe := new(big.Float).SetPrec(prec).Mul(spanX, half)
+	centerRe.Add(centerRe, p.Exact.MinX)
+	centerIm := new(big.Float).SetPrec(prec).Mul(spanY, half)
+	centerIm.Add(centerIm, p.Exact.MinY)
+
+	mandelbrotMode := p.Fractal == julia.Mandelbrot
+	zRe, zIm := centerRe, centerIm
+	cRe, cIm := big.NewFloat(real(p.C)), big.NewFloat(imag(p.C))
+	if mandelbrotMode {
+		zRe, zIm = new(big.Float).SetPrec(prec), new(big.Float).SetPrec(prec)
+		cRe, cIm = centerRe, centerIm
+	}
+
+	orbit, fromStart := referenceOrbit(zRe, zIm, cRe, cIm, p.MaxIter, p.EscapeRadius, prec)
+	return &perturbation{
+		p:              p,
+		orbit:          orbit,
+		fromStart:      fromStart,
+		spanX:          sx,
+		spanY:          sy,
+		er2:            p.EscapeRadius * p.EscapeRadius,
+		mandelbrotMode: mandelbrotMode,
+		distance:       p.Channel == julia.Distance,
+	}
+}
+
+// referenceOrbit iterates z² + c at precision prec and returns the orbit
+// and each point's offset from the first, both rounded to complex128. It
+// stops after the first point outside the escape radius or after maxIter
+// steps, but always holds at least two points.
+func referenceOrbit(z0Re, z0Im, cRe, cIm *big.Float, maxIter int, escapeRadius float64, prec uint) (orbit, fromStart []complex128) {
+	zr := new(big.Float).SetPrec(prec).Set(z0Re)
+	zi := new(big.Float).SetPrec(prec).Set(z0Im)
+	t := new(big.Float).SetPrec(prec)
+	er2 := escapeRadius * escapeRadius
+
+	orbit = make([]complex128, 0, maxIter+1)
+	fromStart = make([]complex128, 0, maxIter+1)
+	for n := 0; ; n++ {
+		fr, _ := zr.Float64()
+		fi, _ := zi.Float64()
+		orbit = append(orbit, complex(fr, fi))
+		dr, _ := t.Sub(zr, z0Re).Float64()
+		di, _ := t.Sub(zi, z0Im).Float64()
+		fromStart = append(fromStart, complex(dr, di))
+		if n == maxIter || (len(orbit) >= 2 && !(fr*fr+fi*fi <= er2)) {
+			return orbit, fromStart
+		}
+
+		// z = z² + c
+		t.Mul(zr, zi)
+		zr.Mul(zr, zr)
+		zi.Mul(zi, zi)
+		zr.Sub(zr, zi)
+		zr.Add(zr, cRe)
+		zi.Add(t, t)
+		zi.Add(zi, cIm)
+	}
+}
+
+// row fills row, holding row py of the image, and returns the number of
+// iterations performed.
+func (pt *perturbation) row(py int, row []float32) int {
+	p := pt.p
+	orbit, fromStart := pt.orbit, pt.fromStart
+	last := len(orbit) - 1
+	offIm := pt.spanY * (float64(py)/float64(p.Height) - 0.5)
+	iters := 0
+
+	for px := 0; px < p.Width; px++ {
+		off := complex(pt.spanX*(float64(px)/float64(p.Width)-0.5), offIm)
+		delta, deltaC := off, complex128(0)
+		dz := complex(1, 0)
+		if pt.mandelbrotMode {
+			delta, deltaC = 0, off
+			dz = 0
+		}
+
+		v := julia.InteriorSentinel
+		n := p.MaxIter
+		m := 0
+		for i := 0; i < p.MaxIter; i++ {
+			z := orbit[m] + delta
+			zr, zi := real(z), imag(z)
+			mag2 := zr*zr + zi*zi
+			if !(mag2 <= pt.er2) {
+				if pt.distance {
+					v = julia.DistanceEstimate(mag2, dz)
+				} else {
+					v = julia.SmoothCount(i, mag2, 2)
+				}
+				n = i
+				break
+			}
+			if pt.distance {
+				dz = 2 * z * dz
+				if pt.mandelbrotMode {
+					dz++
+				}
+			}
+
+			if rebased := fromStart[m] + delta; m == last || squaredAbs(rebased) < squaredAbs(delta) {
+				delta = rebased
+				m = 0
+			}
+			delta = 2*orbit[m]*delta + delta*delta + deltaC
+			m++
+		}
+		row[px] = float32(v)
+		iters += n
+	}
+	return iters
+}
+
+func squaredAbs(z complex128) float64 {
+	return real(z)*real(z) + imag(z)*imag(z)
+}
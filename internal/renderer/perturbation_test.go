@@ -0,0 +1,177 @@
+package renderer
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/kqnade/julia-web-server/internal/julia"
+)
+
+// deepParams returns a width x height viewport of the given span centred
+// on (re, im), with exact bounds at prec bits.
+func deepParams(fractal julia.Fractal, re, im string, span float64, width, height, maxIter int, prec uint) julia.Params {
+	center := func(s string) *big.Float {
+		f, _, _ := big.ParseFloat(s, 10, prec, big.ToNearestEven)
+		return f
+	}
+	halfSpan := new(big.Float).SetPrec(prec).SetFloat64(span / 2)
+	cr, ci := center(re), center(im)
+	v := &julia.Viewport{
+		MinX: new(big.Float).SetPrec(prec).Sub(cr, halfSpan),
+		MaxX: new(big.Float).SetPrec(prec).Add(cr, halfSpan),
+		MinY: new(big.Float).SetPrec(prec).Sub(ci, halfSpan),
+		MaxY: new(big.Float).SetPrec(prec).Add(ci, halfSpan),
+	}
+	p := julia.Params{
+		Fractal:      fractal,
+		C:            -0.7 + 0.27015i,
+		Width:        width,
+		Height:       height,
+		MaxIter:      maxIter,
+		EscapeRadius: julia.DefaultEscapeRadius,
+		Prec:         prec,
+		Exact:        v,
+	}
+	p.MinX, _ = v.MinX.Float64()
+	p.MaxX, _ = v.MaxX.Float64()
+	p.MinY, _ = v.MinY.Float64()
+	p.MaxY, _ = v.MaxY.Float64()
+	return p
+}
+
+// compareWithBig renders p by perturbation and by brute-force math/big and
+// checks that at most maxMismatch pixels disagree.
+func compareWithBig(t *testing.T, p julia.Params, maxMismatch int) {
+	t.Helper()
+	pt := newPerturbation(p)
+	if pt == nil {
+		t.Fatal("newPerturbation returned nil")
+	}
+	got := make([]float32, p.Width*p.Height)
+	for py := 0; py < p.Height; py++ {
+		pt.row(py, got[py*p.Width:(py+1)*p.Width])
+	}
+
+	mismatches := 0
+	escaped := 0
+	for py := 0; py < p.Height; py++ {
+		for px := 0; px < p.Width; px++ {
+			_, want, _ := julia.EvaluateBig(px, py, p)
+			g := float64(got[py*p.Width+px])
+			if want >= 0 {
+				escaped++
+			}
+			if (g < 0) != (want < 0) || math.Abs(g-want) > 0.05 {
+				mismatches++
+			}
+		}
+	}
+	if mismatches > maxMismatch {
+		t.Errorf("%d of %d pixels differ from math/big, want at most %d", mismatches, p.Width*p.Height, maxMismatch)
+	}
+	if escaped == 0 {
+		t.Error("no pixel escaped; viewport does not exercise the boundary")
+	}
+}
+
+func TestPerturbation_MandelbrotDeepZoom(t *testing.T) {
+	// c = i is a Misiurewicz point on the boundary of the Mandelbrot set.
+	p := deepParams(julia.Mandelbrot, "0.0000000000000000000003", "1.0000000000000000000001", 1e-20, 12, 12, 2000, 128)
+	compareWithBig(t, p, 3)
+}
+
+func TestPerturbation_JuliaDeepZoom(t *testing.T) {
+	// The repelling fixed point (1 + sqrt(1 - 4c)) / 2 lies on the Julia set.
+	p := deepParams(julia.Julia, "1.4842927481401906", "-0.13723051425017874", 1e-15, 12, 12, 1000, 128)
+	compareWithBig(t, p, 3)
+}
+
+func TestPerturbation_ShallowMatchesFloat64(t *testing.T) {
+	p := defaultParams(32, 24)
+	want := render(t, p)
+
+	p.Prec = 64
+	p.Exact = julia.ViewportOf(p)
+	pt := newPerturbation(p)
+	if pt == nil {
+		t.Fatal("newPerturbation returned nil")
+	}
+	got := make([]float32, len(want))
+	for py := 0; py < p.Height; py++ {
+		pt.row(py, got[py*p.Width:(py+1)*p.Width])
+	}
+
+	mismatches := 0
+	for i := range want {
+		if (want[i] < 0) != (got[i] < 0) || math.Abs(float64(want[i]-got[i])) > 1e-3 {
+			mismatches++
+		}
+	}
+	if mismatches > 0 {
+		t.Errorf("%d of %d pixels differ from float64 rendering", mismatches, len(want))
+	}
+}
+
+func TestPerturbation_DistanceMatchesFloat64(t *testing.T) {
+	for _, fractal := range []julia.Fractal{julia.Julia, julia.Mandelbrot} {
+		t.Run(fractal.String(), func(t *testing.T) {
+			p := defaultParams(32, 24)
+			p.Fractal = fractal
+			p.Channel = julia.Distance
+			p.EscapeRadius = julia.DistanceEscapeRadius
+			want := render(t, p)
+
+			p.Prec = 64
+			p.Exact = julia.ViewportOf(p)
+			pt := newPerturbation(p)
+			if pt == nil {
+				t.Fatal("newPerturbation returned nil")
+			}
+			got := make([]float32, len(want))
+			for py := 0; py < p.Height; py++ {
+				pt.row(py, got[py*p.Width:(py+1)*p.Width])
+			}
+
+			mismatches := 0
+			for i := range want {
+				if (want[i] < 0) != (got[i] < 0) || math.Abs(float64(want[i]-got[i])) > 1e-3*math.Abs(float64(want[i])) {
+					mismatches++
+				}
+			}
+			if mismatches > 0 {
+				t.Errorf("%d of %d pixels differ from float64 rendering", mismatches, len(want))
+			}
+		})
+	}
+}
+
+func TestNewPerturbation_Unsupported(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*julia.Params)
+	}{
+		{"float64 params", func(p *julia.Params) { p.Prec, p.Exact = 0, nil }},
+		{"cubic", func(p *julia.Params) { p.Power = 3 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := deepParams(julia.Mandelbrot, "-0.75", "0.1", 1e-20, 4, 4, 100, 128)
+			tt.mutate(&p)
+			if newPerturbation(p) != nil {
+				t.Error("newPerturbation returned a renderer, want nil")
+			}
+		})
+	}
+}
+
+func TestReferenceOrbit_AlwaysTwoPoints(t *testing.T) {
+	// Z0 = 10 is already outside the escape radius.
+	orbit, fromStart := referenceOrbit(big.NewFloat(10), big.NewFloat(0), big.NewFloat(0), big.NewFloat(0), 100, julia.DefaultEscapeRadius, 64)
+	if len(orbit) != 2 || len(fromStart) != 2 {
+		t.Fatalf("orbit length = %d, want 2", len(orbit))
+	}
+	if orbit[1] != 100 || fromStart[1] != 90 {
+		t.Errorf("orbit[1] = %v, fromStart[1] = %v; want 100, 90", orbit[1], fromStart[1])
+	}
+}
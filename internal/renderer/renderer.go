@@ -1,54 +1,212 @@
 package renderer
 
 import (
+	"context"
+	"errors"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/kqnade/julia-web-server/internal/julia"
+	"github.com/kqnade/julia-web-server/internal/metrics"
+	"github.com/kqnade/julia-web-server/internal/pool"
 )
 
-// Render computes the Julia set for the given parameters and returns a
+// DefaultQueueDepth is the number of renders the default pool admits at once.
+const DefaultQueueDepth = 64
+
+// stripRetryInterval is how long RenderStrips waits for room in a full pool.
+const stripRetryInterval = 50 * time.Millisecond
+
+// Renderer renders on a worker pool of its own.
+type Renderer struct {
+	workers *pool.Pool
+}
+
+// New returns a Renderer that submits the rows of every render to workers.
+// Closing workers makes further renders fail with pool.ErrClosed.
+func New(workers *pool.Pool) *Renderer {
+	return &Renderer{workers: workers}
+}
+
+// defaultRenderer serves the package-level functions. Its pool is only
+// started on first use.
+var defaultRenderer = sync.OnceValue(func() *Renderer {
+	return New(pool.New(runtime.NumCPU(), DefaultQueueDepth))
+})
+
+// Render metrics, served by metrics.Handler.
+var (
+	renderDuration = metrics.NewHistogram("julia_render_compute_seconds",
+		"Compute time of completed renders, one per Render or RenderStrips call; cache hits and requests sharing another render are not observed.", metrics.DurationBuckets)
+	rendersInFlight = metrics.NewGauge("julia_renders_in_flight",
+		"Renders currently running or waiting for the worker pool.")
+	pixelsTotal = metrics.NewCounter("julia_pixels_total",
+		"Pixels computed, counted as each row finishes.")
+	iterationsTotal = metrics.NewCounter("julia_iterations_total",
+		"Iterations of the fractal map performed, counted as each row finishes.")
+)
+
+// Render computes the Julia or Mandelbrot set for the given parameters and returns a
 // float32 slice of length Width*Height in row-major order (left-to-right,
-// top-to-bottom). Each value is the smooth iteration count (>= 0 for escaped
-// points, -1.0 for interior points).
-func Render(p julia.Params) []float32 {
+// top-to-bottom). Each value is the smooth iteration count, or with
+// p.Channel == julia.Distance the distance estimate, for escaped points
+// (>= 0) and p.InteriorValue() for interior points.
+//
+// With p.Prec > 0, coordinates use math/big at that precision. Sets of
+// z^2 + c are then iterated by perturbation around one math/big reference
+// orbit; other degrees and formulas iterate every pixel in math/big and
+// support only the smooth channel.
+//
+// Rows are computed on the worker pool of r. If the pool is full, Render
+// returns pool.ErrQueueFull. If ctx is cancelled, Render stops at the next
+// row and returns ctx.Err(). In both cases the buffer is nil.
+func (r *Renderer) Render(ctx context.Context, p julia.Params) ([]float32, error) {
+	return r.RenderProgress(ctx, p, nil)
+}
+
+// Render is Renderer.Render on a default pool of runtime.NumCPU() workers.
+func Render(ctx context.Context, p julia.Params) ([]float32, error) {
+	return defaultRenderer().Render(ctx, p)
+}
+
+// RenderProgress is Render with a progress hook: unless it is nil, progress
+// is called once for every finished row, possibly from several goroutines
+// at once.
+func (r *Renderer) RenderProgress(ctx context.Context, p julia.Params, progress func()) ([]float32, error) {
 	if p.Width <= 0 || p.Height <= 0 {
-		return []float32{}
+		return []float32{}, nil
 	}
 
+	rendersInFlight.Inc()
+	defer rendersInFlight.Dec()
+	start := time.Now()
+
 	buf := make([]float32, p.Width*p.Height)
+	fill := fillFunc(p, progress)
+	err := r.workers.Do(ctx, p.Height, func(py int) {
+		fill(py, buf[py*p.Width:(py+1)*p.Width])
+	})
+	if err != nil {
+		return nil, err
+	}
+	renderDuration.Observe(time.Since(start).Seconds())
+	return buf, nil
+}
 
-	numWorkers := runtime.NumCPU()
-	if numWorkers > p.Height {
-		numWorkers = p.Height
+// RenderStrips renders p in strips of stripRows rows, so that at most one
+// strip is held in memory at a time. emit is called with each strip in
+// order, from the calling goroutine, with y0 the index of its first row;
+// the strip is reused once emit returns. progress is called as for
+// RenderProgress.
+//
+// Each strip is submitted to the pool separately. A strip that finds
+// the pool full waits and tries again rather than abandoning the strips
+// already emitted, so RenderStrips only fails when ctx is cancelled or emit
+// returns an error, which it then returns.
+func (r *Renderer) RenderStrips(ctx context.Context, p julia.Params, stripRows int, emit func(y0 int, strip []float32) error, progress func()) error {
+	if p.Width <= 0 || p.Height <= 0 {
+		return nil
 	}
-	if numWorkers < 1 {
-		numWorkers = 1
+	stripRows = max(1, min(stripRows, p.Height))
+	rendersInFlight.Inc()
+	defer rendersInFlight.Dec()
+	start := time.Now()
+
+	buf := make([]float32, stripRows*p.Width)
+	fill := fillFunc(p, progress)
+	for y0 := 0; y0 < p.Height; y0 += stripRows {
+		strip := buf[:min(stripRows, p.Height-y0)*p.Width]
+		task := func(i int) {
+			fill(y0+i, strip[i*p.Width:(i+1)*p.Width])
+		}
+		for {
+			err := r.workers.Do(ctx, len(strip)/p.Width, task)
+			if !errors.Is(err, pool.ErrQueueFull) {
+				if err != nil {
+					return err
+				}
+				break
+			}
+			select {
+			case <-time.After(stripRetryInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := emit(y0, strip); err != nil {
+			return err
+		}
 	}
+	renderDuration.Observe(time.Since(start).Seconds())
+	return nil
+}
 
-	var wg sync.WaitGroup
-	rowsPerWorker := p.Height / numWorkers
+// RenderStrips is Renderer.RenderStrips on the pool of Render.
+func RenderStrips(ctx context.Context, p julia.Params, stripRows int, emit func(y0 int, strip []float32) error, progress func()) error {
+	return defaultRenderer().RenderStrips(ctx, p, stripRows, emit, progress)
+}
 
-	for w := 0; w < numWorkers; w++ {
-		startRow := w * rowsPerWorker
-		endRow := startRow + rowsPerWorker
-		if w == numWorkers-1 {
-			endRow = p.Height
+// fillFunc returns the function that fills row py of p, including the
+// interior value, progress hook and pixel and iteration counters.
+func fillFunc(p julia.Params, progress func()) func(py int, row []float32) {
+	fill := rowFunc(p)
+	if p.Interior != nil {
+		fill = withInterior(fill, *p.Interior)
+	}
+	return func(py int, row []float32) {
+		iters := fill(py, row)
+		pixelsTotal.Add(uint64(len(row)))
+		iterationsTotal.Add(uint64(iters))
+		if progress != nil {
+			progress()
 		}
+	}
+}
 
-		wg.Add(1)
-		go func(startRow, endRow int) {
-			defer wg.Done()
-			for py := startRow; py < endRow; py++ {
-				for px := 0; px < p.Width; px++ {
-					z0 := julia.PixelToComplex(px, py, p.Width, p.Height, p)
-					_, smooth := julia.Iterate(z0, p.C, p.MaxIter, p.EscapeRadius)
-					buf[py*p.Width+px] = float32(smooth)
-				}
+// rowFunc returns the function that fills row, holding row py of p, and
+// returns the number of iterations it performed.
+func rowFunc(p julia.Params) func(py int, row []float32) int {
+	if p.Prec > 0 {
+		if pt := newPerturbation(p); pt != nil {
+			return pt.row
+		}
+		return func(py int, row []float32) int {
+			iters := 0
+			for px := range row {
+				_, smooth, n := julia.EvaluateBig(px, py, p)
+				row[px] = float32(smooth)
+				iters += n
 			}
-		}(startRow, endRow)
+			return iters
+		}
+	}
+	evaluate := julia.Evaluate
+	if p.Channel == julia.Distance {
+		evaluate = julia.EvaluateDistance
+	}
+	return func(py int, row []float32) int {
+		iters := 0
+		for px := range row {
+			pt := julia.PixelToComplex(px, py, p.Width, p.Height, p)
+			_, v, n := evaluate(pt, p)
+			row[px] = float32(v)
+			iters += n
+		}
+		return iters
 	}
+}
 
-	wg.Wait()
-	return buf
+// withInterior wraps fill so that interior points of each row it fills
+// are set to interior instead of julia.InteriorSentinel.
+func withInterior(fill func(py int, row []float32) int, interior float32) func(py int, row []float32) int {
+	return func(py int, row []float32) int {
+		iters := fill(py, row)
+		for i, v := range row {
+			if v == julia.InteriorSentinel {
+				row[i] = interior
+			}
+		}
+		return iters
+	}
 }
@@ -1,11 +1,26 @@
 package renderer
 
 import (
+	"context"
+	"errors"
+	"math"
+	"math/cmplx"
+	"sync/atomic"
 	"testing"
 
 	"github.com/kqnade/julia-web-server/internal/julia"
 )
 
+// render calls Render with a background context and fails the test on error.
+func render(t *testing.T, p julia.Params) []float32 {
+	t.Helper()
+	buf, err := Render(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Render: unexpected error: %v", err)
+	}
+	return buf
+}
+
 func defaultParams(width, height int) julia.Params {
 	return julia.Params{
 		MinX:         -2,
@@ -32,7 +47,7 @@ func TestRender_BufferLength(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			buf := Render(defaultParams(tt.width, tt.height))
+			buf := render(t, defaultParams(tt.width, tt.height))
 			want := tt.width * tt.height
 			if len(buf) != want {
 				t.Errorf("Render(%d, %d): len = %d, want %d", tt.width, tt.height, len(buf), want)
@@ -54,7 +69,7 @@ func TestRender_AllEscaping(t *testing.T) {
 		MaxIter:      256,
 		EscapeRadius: julia.DefaultEscapeRadius,
 	}
-	buf := Render(p)
+	buf := render(t, p)
 	for i, v := range buf {
 		if v < 0 {
 			t.Fatalf("buf[%d] = %f, want >= 0 (all points should escape)", i, v)
@@ -75,7 +90,7 @@ func TestRender_InteriorPoints(t *testing.T) {
 		MaxIter:      256,
 		EscapeRadius: julia.DefaultEscapeRadius,
 	}
-	buf := Render(p)
+	buf := render(t, p)
 	for i, v := range buf {
 		if v != -1.0 {
 			t.Fatalf("buf[%d] = %f, want -1.0 (interior points)", i, v)
@@ -83,10 +98,137 @@ func TestRender_InteriorPoints(t *testing.T) {
 	}
 }
 
+func TestRender_InteriorValue(t *testing.T) {
+	p := defaultParams(32, 24)
+	want := render(t, p)
+
+	nan := float32(math.NaN())
+	p.Interior = &nan
+	got := render(t, p)
+
+	for i := range want {
+		if want[i] == -1.0 {
+			if !math.IsNaN(float64(got[i])) {
+				t.Errorf("buf[%d] = %v, want NaN (interior point)", i, got[i])
+			}
+		} else if got[i] != want[i] {
+			t.Errorf("buf[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRender_Mandelbrot(t *testing.T) {
+	// Region around c = -0.1: inside the main cardioid, so nothing escapes
+	p := julia.Params{
+		Fractal:      julia.Mandelbrot,
+		MinX:         -0.15,
+		MaxX:         -0.05,
+		MinY:         -0.05,
+		MaxY:         0.05,
+		Width:        8,
+		Height:       8,
+		MaxIter:      256,
+		EscapeRadius: julia.DefaultEscapeRadius,
+	}
+	buf := render(t, p)
+	for i, v := range buf {
+		if v != -1.0 {
+			t.Fatalf("buf[%d] = %f, want -1.0 (inside main cardioid)", i, v)
+		}
+	}
+}
+
+func TestRender_Distance(t *testing.T) {
+	// For c = 0 the Julia set is the unit circle, so the distance from a
+	// pixel at |z| > 1 is |z| - 1 and the estimate is within a factor of 4.
+	p := defaultParams(32, 32)
+	p.MinX, p.MaxX, p.MinY, p.MaxY = -2, 2, -2, 2
+	p.C = 0
+	p.Channel = julia.Distance
+	p.EscapeRadius = julia.DistanceEscapeRadius
+	buf := render(t, p)
+
+	for py := 0; py < p.Height; py++ {
+		for px := 0; px < p.Width; px++ {
+			v := float64(buf[py*p.Width+px])
+			r := cmplx.Abs(julia.PixelToComplex(px, py, p.Width, p.Height, p))
+			switch {
+			case r < 1:
+				if v != -1.0 {
+					t.Errorf("pixel (%d, %d) at |z| = %v: got %v, want -1.0", px, py, r, v)
+				}
+			case r > 1.01:
+				if d := r - 1; v < d/4*0.99 || v > d*1.01 {
+					t.Errorf("pixel (%d, %d) at |z| = %v: distance %v, want in [%v, %v]", px, py, r, v, d/4, d)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderStrips_MatchesRender(t *testing.T) {
+	p := defaultParams(24, 20)
+	want := render(t, p)
+
+	got := make([]float32, 0, len(want))
+	var rows atomic.Int32
+	next := 0
+	err := RenderStrips(context.Background(), p, 7, func(y0 int, strip []float32) error {
+		if y0 != next {
+			t.Errorf("strip starts at row %d, want %d", y0, next)
+		}
+		next += len(strip) / p.Width
+		got = append(got, strip...)
+		return nil
+	}, func() { rows.Add(1) })
+	if err != nil {
+		t.Fatalf("RenderStrips: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d values, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("value %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if n := rows.Load(); n != int32(p.Height) {
+		t.Errorf("progress called %d times, want %d", n, p.Height)
+	}
+}
+
+func TestRenderStrips_EmitError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := RenderStrips(context.Background(), defaultParams(8, 8), 2, func(int, []float32) error {
+		calls++
+		return stop
+	}, nil)
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("RenderStrips = %v after %d strips, want stop after 1", err, calls)
+	}
+}
+
+func TestRender_HighPrecisionMatchesFloat64(t *testing.T) {
+	p := defaultParams(16, 12)
+	want := render(t, p)
+
+	p.Prec = 128
+	p.Exact = julia.ViewportOf(p)
+	got := render(t, p)
+
+	for i := range want {
+		if (want[i] < 0) != (got[i] < 0) || math.Abs(float64(want[i]-got[i])) > 1e-3 {
+			t.Errorf("buf[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
 func TestRender_Deterministic(t *testing.T) {
 	p := defaultParams(64, 64)
-	buf1 := Render(p)
-	buf2 := Render(p)
+	buf1 := render(t, p)
+	buf2 := render(t, p)
 
 	if len(buf1) != len(buf2) {
 		t.Fatalf("different lengths: %d vs %d", len(buf1), len(buf2))
@@ -98,6 +240,33 @@ func TestRender_Deterministic(t *testing.T) {
 	}
 }
 
+func TestRender_Metrics(t *testing.T) {
+	p := defaultParams(20, 10)
+	var wantIters uint64
+	for py := range p.Height {
+		for px := range p.Width {
+			_, _, n := julia.Evaluate(julia.PixelToComplex(px, py, p.Width, p.Height, p), p)
+			wantIters += uint64(n)
+		}
+	}
+
+	pixels, iters, renders := pixelsTotal.Value(), iterationsTotal.Value(), renderDuration.Count()
+	render(t, p)
+
+	if got := pixelsTotal.Value() - pixels; got != 200 {
+		t.Errorf("pixels counted = %d, want 200", got)
+	}
+	if got := iterationsTotal.Value() - iters; got != wantIters {
+		t.Errorf("iterations counted = %d, want %d", got, wantIters)
+	}
+	if got := renderDuration.Count() - renders; got != 1 {
+		t.Errorf("durations observed = %d, want 1", got)
+	}
+	if n := rendersInFlight.Value(); n != 0 {
+		t.Errorf("renders in flight = %d after Render returned, want 0", n)
+	}
+}
+
 func TestRender_ZeroDimension_NoPanic(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -109,10 +278,23 @@ func TestRender_ZeroDimension_NoPanic(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			buf := Render(defaultParams(tt.width, tt.height))
+			buf := render(t, defaultParams(tt.width, tt.height))
 			if len(buf) != 0 {
 				t.Errorf("Render(%d, %d): len = %d, want 0", tt.width, tt.height, len(buf))
 			}
 		})
 	}
 }
+
+func TestRender_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	buf, err := Render(ctx, defaultParams(64, 64))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if buf != nil {
+		t.Errorf("buf has %d values, want nil", len(buf))
+	}
+}
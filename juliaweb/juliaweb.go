@@ -0,0 +1,250 @@
+// Package juliaweb serves the Julia set visualizer, its web UI and HTTP API,
+// as an http.Handler that can be mounted in any server.
+//
+//	h, err := juliaweb.New(juliaweb.Options{BasePath: "/fractals"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer h.Close()
+//	mux.Handle("/fractals/", h)
+//
+// Each Handler has its own worker pool, tile cache, job manager and limits,
+// so several can be mounted in one process. Metrics are process-wide and
+// count the work of every Handler.
+package juliaweb
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/kqnade/julia-web-server/internal/accesslog"
+	"github.com/kqnade/julia-web-server/internal/cache"
+	"github.com/kqnade/julia-web-server/internal/handler"
+	"github.com/kqnade/julia-web-server/internal/jobs"
+	"github.com/kqnade/julia-web-server/internal/metrics"
+	"github.com/kqnade/julia-web-server/internal/pool"
+	"github.com/kqnade/julia-web-server/internal/renderer"
+	"github.com/kqnade/julia-web-server/web"
+)
+
+// Limits are the request defaults and limits: default image size and
+// max_iter, and the largest accepted sizes and max_iter.
+type Limits = handler.Limits
+
+// DefaultLimits are the limits used when Options.Limits is zero.
+var DefaultLimits = handler.DefaultLimits
+
+// Defaults for zero Options fields.
+const (
+	DefaultQueueDepth = renderer.DefaultQueueDepth
+	DefaultCacheBytes = handler.DefaultCacheBytes
+	DefaultMaxJobs    = handler.DefaultMaxJobs
+	DefaultJobTTL     = handler.DefaultJobTTL
+)
+
+// Options configure a Handler. The zero value serves the UI and API at the
+// root with default limits.
+type Options struct {
+	// BasePath is the URL prefix of the UI and API, such as "/fractals",
+	// without a trailing slash. Empty serves them at the root.
+	BasePath string
+
+	// Limits are the request limits. The zero value means DefaultLimits.
+	Limits Limits
+
+	// Logger receives one access log record per request. Nil means
+	// slog.Default(); use slog.DiscardHandler to turn access logs off.
+	Logger *slog.Logger
+
+	// MetricsPath, if set, serves Prometheus metrics at that path,
+	// independent of BasePath.
+	MetricsPath string
+
+	// Workers is the number of render worker goroutines; zero means
+	// runtime.NumCPU(). QueueDepth is the number of renders admitted at
+	// once; zero means DefaultQueueDepth.
+	Workers    int
+	QueueDepth int
+
+	// CacheBytes is the size of the tile cache; zero means
+	// DefaultCacheBytes and a negative value disables caching.
+	CacheBytes int64
+
+	// MaxJobs is the number of background jobs held at once and JobTTL how
+	// long finished jobs are kept; zero means DefaultMaxJobs and
+	// DefaultJobTTL.
+	MaxJobs int
+	JobTTL  time.Duration
+}
+
+// Handler serves the UI and API. Requests outside its routes get 404.
+type Handler struct {
+	h       http.Handler
+	workers *pool.Pool
+	jobs    *jobs.Manager
+}
+
+// New returns a Handler configured by opts. The Handler serves its routes
+// under opts.BasePath, so it must be mounted without stripping the prefix.
+func New(opts Options) (*Handler, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	limits := opts.Limits
+	if limits == (Limits{}) {
+		limits = DefaultLimits
+	}
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+	assets, err := loadAssets(opts.BasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pool and job manager start last and are closed again if New
+	// fails after all.
+	workers := pool.New(cmp.Or(opts.Workers, runtime.NumCPU()), cmp.Or(opts.QueueDepth, DefaultQueueDepth))
+	r := renderer.New(workers)
+	renderJobs := jobs.New(cmp.Or(opts.MaxJobs, DefaultMaxJobs), cmp.Or(opts.JobTTL, DefaultJobTTL), r.RenderProgress)
+	srv, err := handler.New(limits, r, cache.New(cmp.Or(opts.CacheBytes, DefaultCacheBytes)), renderJobs)
+	if err != nil {
+		renderJobs.Close()
+		workers.Close()
+		return nil, err
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Handler{
+		h:       accesslog.Middleware(logger, newMux(opts.BasePath, opts.MetricsPath, assets, srv)),
+		workers: workers,
+		jobs:    renderJobs,
+	}, nil
+}
+
+// validate reports options that New cannot serve. Limits are checked by
+// Limits.Validate.
+func (opts Options) validate() error {
+	for _, p := range []struct{ name, path string }{
+		{"base path", opts.BasePath},
+		{"metrics path", opts.MetricsPath},
+	} {
+		if p.path != "" && (!strings.HasPrefix(p.path, "/") || strings.HasSuffix(p.path, "/") || strings.ContainsAny(p.path, " {}?#")) {
+			return fmt.Errorf("juliaweb: %s must start with /, not end with / and be a plain URL path, got %q", p.name, p.path)
+		}
+	}
+	switch {
+	case opts.Workers < 0:
+		return fmt.Errorf("juliaweb: workers must not be negative, got %d", opts.Workers)
+	case opts.QueueDepth < 0:
+		return fmt.Errorf("juliaweb: queue depth must not be negative, got %d", opts.QueueDepth)
+	case opts.MaxJobs < 0:
+		return fmt.Errorf("juliaweb: max jobs must not be negative, got %d", opts.MaxJobs)
+	case opts.JobTTL < 0:
+		return fmt.Errorf("juliaweb: job TTL must not be negative, got %v", opts.JobTTL)
+	}
+	return nil
+}
+
+// ServeHTTP serves the UI and API.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.h.ServeHTTP(w, r)
+}
+
+// Close cancels background jobs, removing their files, and stops the
+// render workers. Call it once the server has stopped serving h.
+func (h *Handler) Close() {
+	h.jobs.Close()
+	h.workers.Close()
+}
+
+// assets are the UI files, with the base path filled in.
+type assets struct {
+	index []byte
+	appJS []byte
+}
+
+// loadAssets reads the UI files for basePath.
+func loadAssets(basePath string) (assets, error) {
+	index, err := renderIndex(basePath)
+	if err != nil {
+		return assets{}, err
+	}
+	appJS, err := fs.ReadFile(web.FS, "app.js")
+	if err != nil {
+		return assets{}, err
+	}
+	return assets{index: index, appJS: appJS}, nil
+}
+
+// newMux routes the UI and the API of srv under basePath, and metrics at
+// metricsPath if it is set.
+func newMux(basePath, metricsPath string, a assets, srv *handler.Server) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// Serve index.html at the base path, with or without a trailing slash
+	serveIndex := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(a.index)
+	}
+	mux.HandleFunc("GET "+basePath+"/{$}", serveIndex)
+	if basePath != "" {
+		mux.HandleFunc("GET "+basePath, serveIndex)
+	}
+
+	// Serve app.js
+	mux.HandleFunc("GET "+basePath+"/app.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+		w.Write(a.appJS)
+	})
+
+	// Julia set computation API
+	mux.HandleFunc("GET "+basePath+"/api", srv.JuliaAPI)
+
+	// Tile cache counters
+	mux.HandleFunc("GET "+basePath+"/cache", srv.CacheStats)
+
+	// Animated GIFs along a path of comp_const values
+	mux.HandleFunc("GET "+basePath+"/animation", srv.JuliaAnimation)
+
+	// Slippy-map XYZ tiles
+	mux.HandleFunc("GET "+basePath+"/tiles/{z}/{x}/{y}", srv.JuliaTiles)
+
+	// Background render jobs
+	mux.HandleFunc("POST "+basePath+"/jobs", srv.CreateJob)
+	mux.HandleFunc("POST "+basePath+"/jobs/poster", srv.CreatePoster)
+	mux.HandleFunc("GET "+basePath+"/jobs/{id}", srv.JobStatus)
+	mux.HandleFunc("GET "+basePath+"/jobs/{id}/result", srv.JobResult)
+	mux.HandleFunc("DELETE "+basePath+"/jobs/{id}", srv.CancelJob)
+
+	// Prometheus metrics
+	if metricsPath != "" {
+		mux.Handle("GET "+metricsPath, metrics.Handler())
+	}
+
+	return mux
+}
+
+// renderIndex fills the base path into the index.html template.
+func renderIndex(basePath string) ([]byte, error) {
+	tmpl, err := template.ParseFS(web.FS, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, struct{ BasePath string }{basePath}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
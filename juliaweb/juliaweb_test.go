@@ -0,0 +1,174 @@
+package juliaweb
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newHandler(t *testing.T, opts Options) *Handler {
+	t.Helper()
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.DiscardHandler)
+	}
+	h, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// view is a minimal set of API parameters.
+const view = "min_x=-2&max_x=2&min_y=-2&max_y=2&comp_const=-0.4,0.6&max_iter=10"
+
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestNew_Routes(t *testing.T) {
+	tests := []struct {
+		name        string
+		basePath    string
+		metricsPath string
+		method      string
+		target      string
+		wantStatus  int
+		wantType    string
+	}{
+		{"root index", "", "", "GET", "/", http.StatusOK, "text/html; charset=utf-8"},
+		{"root app.js", "", "", "GET", "/app.js", http.StatusOK, "application/javascript; charset=utf-8"},
+		{"root api", "", "", "GET", "/api?width=4&height=4&" + view, http.StatusOK, "application/octet-stream"},
+		{"base index", "/fractals", "", "GET", "/fractals", http.StatusOK, "text/html; charset=utf-8"},
+		{"base index with slash", "/fractals", "", "GET", "/fractals/", http.StatusOK, "text/html; charset=utf-8"},
+		{"base app.js", "/fractals", "", "GET", "/fractals/app.js", http.StatusOK, "application/javascript; charset=utf-8"},
+		{"base api", "/fractals", "", "GET", "/fractals/api?width=4&height=4&" + view, http.StatusOK, "application/octet-stream"},
+		{"base tiles", "/fractals", "", "GET", "/fractals/tiles/0/0/0?comp_const=-0.4,0.6&max_iter=10", http.StatusOK, "image/png"},
+		{"base cache", "/fractals", "", "GET", "/fractals/cache", http.StatusOK, "application/json"},
+		{"outside base", "/fractals", "", "GET", "/api", http.StatusNotFound, ""},
+		{"metrics off", "/fractals", "", "GET", "/metrics", http.StatusNotFound, ""},
+		{"metrics on", "/fractals", "/metrics", "GET", "/metrics", http.StatusOK, "text/plain; version=0.0.4; charset=utf-8"},
+		{"wrong method", "/fractals", "", "POST", "/fractals/api", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHandler(t, Options{BasePath: tt.basePath, MetricsPath: tt.metricsPath})
+			w := serve(h, tt.method, tt.target)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantType != "" {
+				if got := w.Header().Get("Content-Type"); got != tt.wantType {
+					t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+				}
+			}
+		})
+	}
+}
+
+func TestNew_IndexBasePath(t *testing.T) {
+	h := newHandler(t, Options{BasePath: "/fractals"})
+	body := serve(h, "GET", "/fractals").Body.String()
+	for _, want := range []string{`src="/fractals/app.js"`, `data-base-path="/fractals"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("index does not contain %s", want)
+		}
+	}
+}
+
+func TestNew_Limits(t *testing.T) {
+	limits := DefaultLimits
+	limits.DefaultWidth = 8
+	limits.DefaultHeight = 2
+	limits.MaxDimension = 16
+	h := newHandler(t, Options{Limits: limits})
+
+	w := serve(h, "GET", "/api?"+view)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if got, want := w.Body.Len(), 8*2*4; got != want {
+		t.Errorf("body length = %d, want %d", got, want)
+	}
+	if w := serve(h, "GET", "/api?width=32&height=2&"+view); w.Code != http.StatusBadRequest {
+		t.Errorf("width above MaxDimension: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestNew_Independent(t *testing.T) {
+	small := DefaultLimits
+	small.DefaultWidth, small.DefaultHeight = 8, 2
+	a := newHandler(t, Options{Limits: small})
+	b, err := New(Options{Logger: slog.New(slog.DiscardHandler)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	bad := DefaultLimits
+	bad.DefaultWidth = bad.MaxDimension + 1
+	if _, err := New(Options{Limits: bad}); err == nil {
+		t.Fatal("New accepted invalid limits")
+	}
+
+	// Neither the second Handler nor the failed New changed the first,
+	// and closing the second leaves the first rendering.
+	if got := serve(b, "GET", "/api?"+view).Body.Len(); got != 256*256*4 {
+		t.Errorf("second handler: body length = %d, want the 256x256 default", got)
+	}
+	b.Close()
+	if w := serve(b, "GET", "/api?"+view+"&width=3"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("closed handler: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	w := serve(a, "GET", "/api?"+view)
+	if w.Code != http.StatusOK || w.Body.Len() != 8*2*4 {
+		t.Errorf("first handler: status %d, body length %d, want 200 with the 8x2 default", w.Code, w.Body.Len())
+	}
+}
+
+func TestNew_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	h := newHandler(t, Options{Logger: slog.New(slog.NewTextHandler(&buf, nil))})
+
+	w := serve(h, "GET", "/api?width=4&height=4&"+view)
+	id := w.Header().Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("no X-Request-ID in response")
+	}
+	for _, want := range []string{"request_id=" + id, "path=/api", "status=200"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %q does not contain %s", buf.String(), want)
+		}
+	}
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	badLimits := DefaultLimits
+	badLimits.DefaultWidth = badLimits.MaxDimension + 1
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"relative base path", Options{BasePath: "fractals"}},
+		{"trailing slash", Options{BasePath: "/fractals/"}},
+		{"pattern in base path", Options{BasePath: "/{id}"}},
+		{"relative metrics path", Options{MetricsPath: "metrics"}},
+		{"negative workers", Options{Workers: -1}},
+		{"negative queue depth", Options{QueueDepth: -1}},
+		{"negative max jobs", Options{MaxJobs: -1}},
+		{"negative job TTL", Options{JobTTL: -1}},
+		{"invalid limits", Options{Limits: badLimits}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if h, err := New(tt.opts); err == nil {
+				h.Close()
+				t.Error("New succeeded, want error")
+			}
+		})
+	}
+}
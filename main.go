@@ -1,52 +1,94 @@
 package main
 
 import (
-	"embed"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/kqnade/julia-web-server/internal/handler"
+	"github.com/kqnade/julia-web-server/internal/config"
+	"github.com/kqnade/julia-web-server/juliaweb"
 )
 
-//go:embed web
-var webFS embed.FS
-
 func main() {
-	webContent, err := fs.Sub(webFS, "web")
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	mux := http.NewServeMux()
-
-	// Serve index.html at /satori/julia
-	mux.HandleFunc("GET /satori/julia", func(w http.ResponseWriter, r *http.Request) {
-		data, err := fs.ReadFile(webContent, "index.html")
-		if err != nil {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Write(data)
-	})
+	logger := newLogger(cfg.LogFormat)
+	slog.SetDefault(logger)
 
-	// Serve app.js
-	mux.HandleFunc("GET /satori/julia/app.js", func(w http.ResponseWriter, r *http.Request) {
-		data, err := fs.ReadFile(webContent, "app.js")
-		if err != nil {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
-		w.Write(data)
+	h, err := juliaweb.New(juliaweb.Options{
+		BasePath:    cfg.BasePath,
+		Limits:      cfg.Limits,
+		Logger:      logger,
+		MetricsPath: "/metrics",
+		Workers:     cfg.Workers,
+		QueueDepth:  cfg.QueueDepth,
+		CacheBytes:  cfg.CacheBytes,
+		MaxJobs:     cfg.MaxJobs,
+		JobTTL:      cfg.JobTTL,
 	})
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(2)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           h,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
 
-	// Julia set computation API
-	mux.HandleFunc("GET /satori/julia/api", handler.JuliaAPI)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	logger.Info("Julia Set server listening", "addr", cfg.Addr, "base_path", cfg.BasePath+"/")
 
-	addr := ":8080"
-	fmt.Printf("Julia Set server listening on http://localhost%s/satori/julia\n", addr)
-	log.Fatal(http.ListenAndServe(addr, mux))
+	select {
+	case err := <-serveErr:
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let in-flight requests, and the renders
+	// they wait on, finish. Past the timeout, closing the connections
+	// cancels their renders.
+	logger.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("in-flight requests did not finish in time", "error", err)
+		srv.Close()
+	}
+	// Nobody can fetch background job results once the server is gone.
+	h.Close()
+	logger.Info("server stopped")
+}
+
+// newLogger returns a logger writing to stderr in the given format, which
+// config.Load has validated.
+func newLogger(format string) *slog.Logger {
+	if format == config.LogJSON {
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
 }
@@ -2,6 +2,7 @@
   "use strict";
 
   var TILE_SIZE = 256;
+  var BASE_PATH = document.currentScript.dataset.basePath;
   var canvas = document.getElementById("canvas");
   var ctx = canvas.getContext("2d");
   var errorEl = document.getElementById("error");
@@ -23,10 +24,21 @@
     var maxY = parseFloat(val("max_y"));
     var cReal = parseFloat(val("c_real"));
     var cImag = parseFloat(val("c_imag"));
+    var pReal = parseFloat(val("p_real"));
+    var pImag = parseFloat(val("p_imag"));
+    var lambdaReal = parseFloat(val("lambda_real"));
+    var lambdaImag = parseFloat(val("lambda_imag"));
+    var fractal = val("fractal");
+    var formula = val("formula");
+    var channel = val("channel");
+    var power = parseFloat(val("power"));
 
     if (!Number.isFinite(minX) || !Number.isFinite(maxX) ||
         !Number.isFinite(minY) || !Number.isFinite(maxY) ||
-        !Number.isFinite(cReal) || !Number.isFinite(cImag)) {
+        !Number.isFinite(cReal) || !Number.isFinite(cImag) ||
+        !Number.isFinite(pReal) || !Number.isFinite(pImag) ||
+        !Number.isFinite(lambdaReal) || !Number.isFinite(lambdaImag) ||
+        !Number.isFinite(power)) {
       errorEl.textContent = "All parameters must be valid finite numbers.";
       btn.disabled = false;
       return;
@@ -60,14 +72,21 @@
           var tMaxY = minY + (maxY - minY) * (pxTop + tileH) / canvasH;
 
           var url =
-            "/satori/julia/api" +
-            "?min_x=" + tMinX +
+            BASE_PATH + "/api" +
+            "?fractal=" + fractal +
+            "&formula=" + formula +
+            "&channel=" + channel +
+            "&min_x=" + tMinX +
             "&max_x=" + tMaxX +
             "&min_y=" + tMinY +
             "&max_y=" + tMaxY +
             "&comp_const=" + encodeURIComponent(cReal + "," + cImag) +
+            "&p=" + encodeURIComponent(pReal + "," + pImag) +
+            "&lambda=" + encodeURIComponent(lambdaReal + "," + lambdaImag) +
             "&width=" + tileW +
-            "&height=" + tileH;
+            "&height=" + tileH +
+            "&power=" + power +
+            "&format=png";
 
           var p = fetch(url).then(function (resp) {
             var ct = resp.headers.get("Content-Type") || "";
@@ -79,33 +98,12 @@
               }
               throw new Error("Server error: " + resp.status + " " + resp.statusText);
             }
-            return resp.arrayBuffer();
-          }).then(function (ab) {
-            var floats = new Float32Array(ab);
-            var imgData = ctx.createImageData(tileW, tileH);
-            var pixels = imgData.data;
-
-            for (var i = 0; i < floats.length; i++) {
-              var smooth = floats[i];
-              var off = i * 4;
-
-              if (smooth < 0) {
-                // Interior: black
-                pixels[off] = 0;
-                pixels[off + 1] = 0;
-                pixels[off + 2] = 0;
-              } else {
-                // HSV coloring
-                var hue = (smooth * 10) % 360;
-                var rgb = hsvToRgb(hue, 1.0, 1.0);
-                pixels[off] = rgb[0];
-                pixels[off + 1] = rgb[1];
-                pixels[off + 2] = rgb[2];
-              }
-              pixels[off + 3] = 255; // alpha
-            }
-
-            ctx.putImageData(imgData, pxLeft, pxTop);
+            return resp.blob();
+          }).then(function (blob) {
+            // Coloring is done server-side so it matches every other consumer
+            return createImageBitmap(blob);
+          }).then(function (bitmap) {
+            ctx.drawImage(bitmap, pxLeft, pxTop);
           });
 
           fetches.push(p);
@@ -126,33 +124,4 @@
       btn.disabled = false;
     });
   }
-
-  // Convert HSV to RGB. h in [0,360), s and v in [0,1].
-  // Returns [r, g, b] each in [0,255].
-  function hsvToRgb(h, s, v) {
-    var c = v * s;
-    var x = c * (1 - Math.abs(((h / 60) % 2) - 1));
-    var m = v - c;
-    var r, g, b;
-
-    if (h < 60) {
-      r = c; g = x; b = 0;
-    } else if (h < 120) {
-      r = x; g = c; b = 0;
-    } else if (h < 180) {
-      r = 0; g = c; b = x;
-    } else if (h < 240) {
-      r = 0; g = x; b = c;
-    } else if (h < 300) {
-      r = x; g = 0; b = c;
-    } else {
-      r = c; g = 0; b = x;
-    }
-
-    return [
-      Math.round((r + m) * 255),
-      Math.round((g + m) * 255),
-      Math.round((b + m) * 255)
-    ];
-  }
 })();
@@ -0,0 +1,10 @@
+// Package web holds the browser UI: index.html, an html/template that takes
+// the base path of the UI and API, and app.js.
+package web
+
+import "embed"
+
+// FS holds index.html and app.js.
+//
+//go:embed index.html app.js
+var FS embed.FS